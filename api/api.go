@@ -2,21 +2,28 @@ package api
 
 import (
 	"bufio"
+	"context"
+	"crypto/rand"
 	"encoding/json"
 	"errors"
 	"io"
 	"io/ioutil"
-	"math/rand"
+	"math/big"
 	"net"
 	"net/http"
-	"strings"
+	"net/url"
+	"path/filepath"
+	"strconv"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
 
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/tylerdixon/bgchooser/bggclient"
+	"github.com/tylerdixon/bgchooser/chooser"
+	"github.com/tylerdixon/bgchooser/config"
 	"github.com/tylerdixon/bgchooser/storage"
 	socketio "gopkg.in/googollee/go-socket.io.v1"
 )
@@ -29,16 +36,17 @@ type API struct {
 	SocketServer *socketio.Server
 	Router       *mux.Router
 	Storage      storage.Storage
+	server       *http.Server
+	sockets      *socketRegistry
+	hub          *roomHub
+	bgg          *bggProbe
+	plays        *playsFetcher
 }
 
 type ConnectionContext struct {
 	Close func() error
 }
 
-func init() {
-	rand.Seed(time.Now().Unix())
-}
-
 var randRunes = []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789")
 
 type loggingResponseWriter struct {
@@ -46,17 +54,21 @@ type loggingResponseWriter struct {
 	w          io.Writer
 	statusCode int
 	body       []byte
+	// hijacked is set once the connection is taken over, such as to upgrade it to a websocket
+	hijacked bool
 }
 
 func (w *loggingResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
 	if hj, ok := w.w.(http.Hijacker); ok {
-		return hj.Hijack()
+		conn, rw, err := hj.Hijack()
+		w.hijacked = err == nil
+		return conn, rw, err
 	}
 	return nil, nil, errors.New("chi/middleware: http.Hijacker is unavailable on the writer")
 }
 
 func newLoggingResponseWriter(w http.ResponseWriter) *loggingResponseWriter {
-	return &loggingResponseWriter{w, w, http.StatusOK, []byte{}}
+	return &loggingResponseWriter{w, w, http.StatusOK, []byte{}, false}
 }
 
 func (lw *loggingResponseWriter) WriteHeader(code int) {
@@ -69,18 +81,23 @@ func (lw *loggingResponseWriter) Write(b []byte) (int, error) {
 	return lw.ResponseWriter.Write(b)
 }
 
-func New() API {
+// New creates the api, serving the web UI from the configured static dir
+func New(stor storage.Storage, cfg config.Config) API {
 	api := API{}
-	stor, err := storage.New()
-	if err != nil {
-		log.Fatal(err)
-		panic(err.Error())
-	}
 	api.Storage = stor
-
-	api.Router = mux.NewRouter().PathPrefix("/api").Subrouter().StrictSlash(false)
-
-	api.Router.PathPrefix("/static/").Handler(http.StripPrefix("/static/", http.FileServer(http.Dir("./build/static/"))))
+	api.sockets = newSocketRegistry()
+	api.hub = newRoomHub(stor.SubscribeToRoomInfo)
+	api.bgg = &bggProbe{}
+	api.plays = newPlaysFetcher(stor)
+
+	// Health checks and metrics are served outside of /api, and aren't logged
+	root := mux.NewRouter()
+	root.HandleFunc("/healthz", api.healthz).Methods("GET")
+	root.HandleFunc("/readyz", api.readyz).Methods("GET")
+	root.Handle("/metrics", promhttp.Handler()).Methods("GET")
+	api.Router = root.PathPrefix("/api").Subrouter().StrictSlash(false)
+
+	api.Router.PathPrefix("/static/").Handler(http.StripPrefix("/static/", http.FileServer(http.Dir(filepath.Join(cfg.StaticDir, "static")))))
 	api.Router.Use(mux.MiddlewareFunc(func(h http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
@@ -103,6 +120,10 @@ func New() API {
 			h.ServeHTTP(lw, r)
 
 			latency := time.Since(start)
+			// A websocket's request lasts as long as the connection, so it would only skew the latencies
+			if !lw.hijacked {
+				observeRequest(r, lw.statusCode, latency)
+			}
 
 			fields := log.Fields{
 				"status": lw.statusCode,
@@ -124,80 +145,136 @@ func New() API {
 
 	// Serve index page on all unhandled routes
 	api.Router.HandleFunc("/init", api.socketInit)
-	api.Router.HandleFunc("/rooms", NewRoom).Methods("POST")
+	api.Router.HandleFunc("/rooms", api.NewRoom).Methods("POST")
 	api.Router.HandleFunc("/rooms/{roomID}", api.GetRoomInfo).Methods("GET")
+	api.Router.HandleFunc("/rooms/{roomID}/state", api.setRoomState).Methods("POST")
+	api.Router.HandleFunc("/rooms/{roomID}/deadline", api.setRoomDeadline).Methods("POST")
+	api.Router.HandleFunc("/rooms/{roomID}/rounds", api.getRounds).Methods("GET")
+	api.Router.HandleFunc("/rooms/{roomID}/rounds", api.startRound).Methods("POST")
 	api.Router.HandleFunc("/rooms/{roomID}/bgguser/{bggUserID}", api.getBggUser).Methods("GET")
 	api.Router.HandleFunc("/rooms/{roomID}/bgguser/{bggUserID}", api.addBggUser).Methods("POST")
 	api.Router.HandleFunc("/rooms/{roomID}/vote/reset", api.resetVotes).Methods("POST")
 	api.Router.HandleFunc("/rooms/{roomID}/vote/{userID}", api.addVotesToRoom).Methods("POST")
 	api.Router.HandleFunc("/rooms/{roomID}/games/{userID}/{gameID}", api.addGame).Methods("POST")
+	api.Router.HandleFunc("/rooms/{roomID}/custom-games", api.addCustomGame).Methods("POST")
+	api.Router.HandleFunc("/rooms/{roomID}/plays/export", api.exportPlays).Methods("GET")
+	api.Router.HandleFunc("/rooms/{roomID}/recommendations", api.getRecommendations).Methods("GET")
+	api.Router.HandleFunc("/rooms/{roomID}/plans", api.getPlans).Methods("GET")
+	api.Router.HandleFunc("/rooms/{roomID}/tables", api.splitTables).Methods("POST")
+	api.Router.HandleFunc("/rooms/{roomID}/pick", api.pickGame).Methods("POST")
+	api.Router.HandleFunc("/groups", api.newGroup).Methods("POST")
+	api.Router.HandleFunc("/groups/{groupID}", api.getGroup).Methods("GET")
+	api.Router.HandleFunc("/groups/{groupID}/members", api.addGroupMember).Methods("POST")
+	api.Router.HandleFunc("/groups/{groupID}/members/{name}", api.removeGroupMember).Methods("DELETE")
+	api.Router.HandleFunc("/groups/{groupID}/library", api.refreshGroupLibrary).Methods("POST")
+	api.Router.HandleFunc("/groups/{groupID}/rooms", api.newGroupRoom).Methods("POST")
+	api.Router.HandleFunc("/groups/{groupID}/history", api.getGroupHistory).Methods("GET")
 	api.Router.PathPrefix("/").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		http.ServeFile(w, r, "./build/index.html")
+		http.ServeFile(w, r, filepath.Join(cfg.StaticDir, "index.html"))
 	})
+	api.server = &http.Server{
+		Handler:      root,
+		ReadTimeout:  cfg.Server.ReadTimeout,
+		WriteTimeout: cfg.Server.WriteTimeout,
+		IdleTimeout:  cfg.Server.IdleTimeout,
+	}
 	return api
 }
 
-func (api *API) socketInit(w http.ResponseWriter, r *http.Request) {
-	c, err := upgrader.Upgrade(w, r, nil)
+// Start begins the api listening on the given port, serving until Shutdown is called. It returns nil
+// if the server was shut down, or the error that stopped it otherwise.
+func (a *API) Start(port string) error {
+	listener, err := net.Listen("tcp", port)
 	if err != nil {
-		log.Print("upgrade:", err)
-		return
-	}
-	defer c.Close()
-	mt, message, err := c.ReadMessage()
-	splitMsg := strings.Split(string(message), ":")
-	if len(splitMsg) < 2 {
-		log.Error(log.Fields{"socketMsg": string(message)}, "Malformed message received in socket init")
-		w.WriteHeader(http.StatusBadRequest)
-		return
+		return err
 	}
-	roomID := splitMsg[1]
-	close := api.Storage.SubscribeToRoomInfo(roomID, func(msg storage.RoomSubscriptionMessage) {
-		log.Info(log.Fields{"roomID": roomID, "msgType": msg.Type}, "Socket event sent")
-		returnMsg, err := json.Marshal(msg)
-		if err != nil {
-			log.Println("Failed to marshal games to emit to user: " + err.Error())
-		}
-		c.WriteMessage(mt, returnMsg)
-	})
-	defer close()
-	shouldClose := false
-	c.SetCloseHandler(func(code int, msg string) error {
-		shouldClose = true
-		close()
+	log.Println("Listening on port " + port)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go a.closeDueRounds(ctx)
+	err = a.server.Serve(listener)
+	if err == http.ErrServerClosed {
 		return nil
-	})
-	for !shouldClose {
-		_, _, err := c.ReadMessage()
-		if err != nil {
-			log.Println("socket err: " + err.Error())
-			break
-		}
 	}
+	return err
 }
 
-// Start begins the api listening on the given port
-func (a *API) Start(port string) error {
-	log.Println("Listening on port " + port)
-	return http.ListenAndServe(port, a.Router)
+// Shutdown stops the api accepting connections and waits for in-flight requests to finish, or for
+// the context to be done. Open websockets are sent a close frame and released from their rooms, also
+// only until the context is done, before the connection to storage is closed.
+func (a *API) Shutdown(ctx context.Context) error {
+	err := a.server.Shutdown(ctx)
+	a.sockets.closeAll(ctx, a.releaseSocket)
+	if closeErr := a.Storage.Close(); err == nil {
+		err = closeErr
+	}
+	return err
 }
 
 type NewRoomRes struct {
-	RoomID string `json:"roomID"`
+	RoomID  string `json:"roomID"`
+	HostKey string `json:"hostKey"`
 }
 
-func NewRoom(w http.ResponseWriter, r *http.Request) {
-	b := make([]rune, 10)
+// randString generates a random ID from crypto/rand, as room IDs and host keys mustn't be guessable
+func randString(n int) string {
+	max := big.NewInt(int64(len(randRunes)))
+	b := make([]rune, n)
 	for i := range b {
-		b[i] = randRunes[rand.Intn(len(randRunes))]
+		idx, err := rand.Int(rand.Reader, max)
+		// crypto/rand only fails if the system can't provide randomness at all
+		if err != nil {
+			panic(err)
+		}
+		b[i] = randRunes[idx.Int64()]
 	}
+	return string(b)
+}
+
+func (a *API) createRoom(ctx context.Context, groupID string) (NewRoomRes, error) {
 	res := NewRoomRes{
-		RoomID: string(b),
+		RoomID:  randString(10),
+		HostKey: randString(20),
+	}
+	err := a.Storage.CreateRoom(ctx, res.RoomID, res.HostKey, groupID)
+	if err != nil {
+		return res, err
+	}
+	a.commitPickSeed(ctx, res.RoomID)
+	return res, nil
+}
+
+type newRoomBody struct {
+	GroupID string `json:"groupID"`
+}
+
+// NewRoom creates a room, returning the key that whoever created it can use to move it between states.
+// Rooms created for a group have their outcome recorded in the group's history.
+func (a *API) NewRoom(w http.ResponseWriter, r *http.Request) {
+	var req newRoomBody
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, r, err, "failed to read body from request")
+		return
+	}
+	// The body is optional, as rooms don't need to belong to a group
+	if len(body) > 0 {
+		err = json.Unmarshal(body, &req)
+		if err != nil {
+			writeBadRequest(w, r, "failed to unmarshal body: "+err.Error())
+			return
+		}
+	}
+
+	res, err := a.createRoom(r.Context(), req.GroupID)
+	if err != nil {
+		writeError(w, r, err, "failed to create room")
+		return
 	}
 	byteRes, err := json.Marshal(res)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(err.Error()))
+		writeError(w, r, err, "failed to marshal new room")
+		return
 	}
 	w.WriteHeader(http.StatusOK)
 	w.Write(byteRes)
@@ -216,15 +293,11 @@ type AddGamesMessage struct {
 
 func (a *API) getBggUser(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
-	roomID := vars["roomID"]
 	bggUserID := vars["bggUserID"]
 
-	games, err := bggclient.GetUserCollection(bggUserID, r)
-
+	games, err := bggclient.GetUserCollection(r.Context(), bggUserID, r.Header.Get("X-Forwarded-For"))
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		// TODO: Scrub error?
-		w.Write([]byte(err.Error()))
+		writeError(w, r, err, "failed to get collection from BGG")
 		return
 	}
 
@@ -233,12 +306,7 @@ func (a *API) getBggUser(w http.ResponseWriter, r *http.Request) {
 	}
 	byteRes, err := json.Marshal(res)
 	if err != nil {
-		log.Error(log.Fields{
-			"roomID":    roomID,
-			"bggUserID": bggUserID,
-		}, err)
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(err.Error()))
+		writeError(w, r, err, "failed to marshal collection")
 		return
 	}
 	w.WriteHeader(http.StatusOK)
@@ -252,35 +320,20 @@ func (a *API) addBggUser(w http.ResponseWriter, r *http.Request) {
 
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		log.Error(log.Fields{
-			"roomID":    roomID,
-			"bggUserID": bggUserID,
-		}, err)
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(err.Error()))
+		writeError(w, r, err, "failed to read body")
 		return
 	}
 
 	var req BggUserGames
 	err = json.Unmarshal(body, &req)
 	if err != nil {
-		log.Error(log.Fields{
-			"roomID":    roomID,
-			"bggUserID": bggUserID,
-		}, err)
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(err.Error()))
+		writeBadRequest(w, r, "failed to unmarshal games: "+err.Error())
 		return
 	}
 
-	err = a.Storage.AddGamesToRoom(roomID, bggUserID, req.Games)
+	err = a.Storage.AddGamesToRoom(r.Context(), roomID, bggUserID, req.Games)
 	if err != nil {
-		log.Error(log.Fields{
-			"roomID":    roomID,
-			"bggUserID": bggUserID,
-		}, err)
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(err.Error()))
+		writeError(w, r, err, "failed to add games to room")
 		return
 	}
 	w.WriteHeader(http.StatusOK)
@@ -288,45 +341,379 @@ func (a *API) addBggUser(w http.ResponseWriter, r *http.Request) {
 }
 
 type GetRoomInfoRes struct {
-	Games       []bggclient.Game   `json:"games"`
-	VoteResults storage.VoteResult `json:"voteResults"`
+	Games        []bggclient.Game     `json:"games"`
+	VoteResults  storage.VoteResult   `json:"voteResults"`
+	State        storage.RoomState    `json:"state"`
+	VoteProgress storage.VoteProgress `json:"voteProgress"`
+	Deadline     *time.Time           `json:"deadline,omitempty"`
+	Round        int                  `json:"round"`
+	Candidates   []string             `json:"candidates,omitempty"`
+	GroupID      string               `json:"groupID,omitempty"`
+	Ranking      []storage.RankedGame `json:"ranking"`
+	// PlayStats summarizes the plays the room's BGG users have logged, keyed by game ID
+	PlayStats map[string]bggclient.PlayStats `json:"playStats,omitempty"`
+	// PickCommitment is the SHA-256 hash of the seed the room's next random pick will use
+	PickCommitment string `json:"pickCommitment"`
+	// Online lists the users with the room open
+	Online []string `json:"online"`
+	// Seq is the sequence number of the latest update to the room the info reflects
+	Seq int64 `json:"seq"`
 }
 
+// GetRoomInfo returns the games and votes for a room. Until votes are revealed, only the ballot of
+// the user given by the `user` query parameter is included, and only along with the `token` issued
+// to them when they first voted. The `recency` query parameter weights
+// the ranking against games chosen within that many of the room's most recent sessions, `rank=rating`
+// ranks games by the group's mean BGG rating rather than votes, and
+// `plays=true` includes when each game was last played by the room's BGG users.
+//
+// The games listed can be narrowed with the `players`, `maxPlaytime`, `minWeight`, `maxWeight`,
+// `owner`, `category` and `mechanics` query parameters, the last two taking comma separated lists
+// that must all match. `sort` orders them by alpha (the default), alphaDesc, playtime, playtimeDesc
+// or votes, matching the web UI, or by lastPlayed to list the games the room's BGG users have gone
+// longest without playing first. Each game is listed once, whichever collections it was added from.
 func (a *API) GetRoomInfo(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	roomID := vars["roomID"]
-	games, err := a.Storage.GetGamesForRoom(roomID)
+	res, err := a.roomInfo(r.Context(), roomID, r.URL.Query())
 	if err != nil {
-		log.Error(log.Fields{
-			"roomID": roomID,
-		}, err)
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("failed to get games for room: " + err.Error()))
+		writeError(w, r, err, "failed to get room")
 		return
 	}
 
-	votes, err := a.Storage.GetUserVotes(roomID)
+	resBody, err := json.Marshal(res)
 	if err != nil {
-		log.Error(log.Fields{
-			"roomID": roomID,
-		}, err)
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("failed to get votes for room: " + err.Error()))
+		writeError(w, r, err, "failed to marshal response for get room")
 		return
 	}
 
-	res := GetRoomInfoRes{
-		Games:       games,
-		VoteResults: votes,
+	w.WriteHeader(http.StatusOK)
+	w.Write(resBody)
+}
+
+// roomInfo builds the response for GetRoomInfo, which is also sent as websocket snapshots. Errors are
+// returned as *Error, describing what failed.
+func (a *API) roomInfo(ctx context.Context, roomID string, query url.Values) (GetRoomInfoRes, error) {
+	var res GetRoomInfoRes
+	rankOpts := storage.RankOptions{
+		Mode: storage.RankMode(query.Get("rank")),
+		Now:  time.Now(),
+	}
+	if rankOpts.Mode != "" && rankOpts.Mode != storage.RankModeVotes && rankOpts.Mode != storage.RankModeRating {
+		return res, badRequest("rank must be either votes or rating")
+	}
+	if param := query.Get("recency"); param != "" {
+		var err error
+		rankOpts.Sessions, err = strconv.Atoi(param)
+		if err != nil || rankOpts.Sessions < 0 {
+			return res, badRequest("recency must be a number of sessions")
+		}
+	}
+	filter, order, err := parseGameFilter(query)
+	if err != nil {
+		return res, badRequest(err.Error())
 	}
 
-	resBody, err := json.Marshal(res)
+	// The sequence number is read first, so any update made while the rest is read comes after it
+	seq, err := a.Storage.GetRoomSeq(ctx, roomID)
+	if err != nil {
+		return res, toError(err, "failed to get latest update for room")
+	}
+
+	meta, err := a.Storage.GetRoomMeta(ctx, roomID)
 	if err != nil {
-		log.Error(log.Fields{
-			"roomID": roomID,
-		}, err)
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("failed to marshal response for get room: " + err.Error()))
+		return res, toError(err, "failed to get state for room")
+	}
+
+	games, err := a.Storage.GetGamesForRoom(ctx, roomID)
+	if err != nil {
+		return res, toError(err, "failed to get games for room")
+	}
+
+	votes, err := a.Storage.GetUserVotes(ctx, roomID)
+	if err != nil {
+		return res, toError(err, "failed to get votes for room")
+	}
+
+	progress, err := a.Storage.GetVoteProgress(ctx, roomID)
+	if err != nil {
+		return res, toError(err, "failed to get vote progress for room")
+	}
+
+	online, err := a.Storage.GetOnlineMembers(ctx, roomID)
+	if err != nil {
+		return res, toError(err, "failed to get online members of room")
+	}
+
+	if meta.State != storage.RoomStateRevealed && meta.State != storage.RoomStateFinished {
+		user := query.Get("user")
+		isVoter, err := a.Storage.IsVoter(ctx, roomID, user, query.Get("token"))
+		if err != nil {
+			return res, toError(err, "failed to check voter for room")
+		}
+		if !isVoter {
+			user = ""
+		}
+		votes = redactVotes(votes, user)
+	}
+
+	if rankOpts.Sessions > 0 {
+		rankOpts.Chosen, err = a.Storage.GetChosenGames(ctx, roomID)
+		if err != nil {
+			return res, toError(err, "failed to get previously chosen games for room")
+		}
+	}
+	userGames, err := a.Storage.GetUserGamesForRoom(ctx, roomID)
+	if err != nil {
+		return res, toError(err, "failed to get ratings for room")
+	}
+	rankOpts.Ratings = storage.GetGroupRatings(userGames)
+
+	var details map[string]bggclient.GameDetails
+	if filter.NeedsDetails() {
+		details, err = a.gameDetails(ctx, games)
+		if err != nil {
+			return res, toError(err, "failed to get game details from BGG")
+		}
+	}
+	var plays map[string]bggclient.PlayStats
+	if query.Get("plays") == "true" || order == chooser.SortLastPlayedAsc {
+		plays, err = a.roomPlayStats(ctx, roomID)
+		if err != nil {
+			return res, toError(err, "failed to get plays for room")
+		}
+	}
+	games = chooser.FilterGames(games, filter, gameOwners(userGames), details)
+	chooser.SortGames(games, order, votes.Tally(), plays)
+
+	res = GetRoomInfoRes{
+		Games:        games,
+		VoteResults:  votes,
+		State:        meta.State,
+		VoteProgress: progress,
+		Round:        meta.Round,
+		Candidates:   meta.Candidates,
+		GroupID:      meta.GroupID,
+		Ranking:      storage.RankGames(games, votes, rankOpts),
+		Online:       online,
+		Seq:          seq,
+	}
+	if !meta.Deadline.IsZero() {
+		res.Deadline = &meta.Deadline
+	}
+	if meta.PickSeed != "" {
+		res.PickCommitment = chooser.Commitment(meta.PickSeed)
+	}
+	if query.Get("plays") == "true" {
+		res.PlayStats = plays
+	}
+	return res, nil
+}
+
+// redactVotes removes every ballot other than the given user's own, or every ballot if no user is given
+func redactVotes(votes storage.VoteResult, user string) storage.VoteResult {
+	redacted := storage.VoteResult{
+		Votes:  make(map[string][]string),
+		Vetoes: make(map[string][]string),
+	}
+	if v, ok := votes.Votes[user]; ok {
+		redacted.Votes[user] = v
+	}
+	if v, ok := votes.Vetoes[user]; ok {
+		redacted.Vetoes[user] = v
+	}
+	return redacted
+}
+
+// checkHost verifies that the given key belongs to the host of a room, writing an error response if it doesn't
+func (a *API) checkHost(w http.ResponseWriter, r *http.Request, roomID, hostKey string) (storage.RoomMeta, bool) {
+	meta, err := a.Storage.GetRoomMeta(r.Context(), roomID)
+	if err != nil {
+		writeError(w, r, err, "failed to get state for room")
+		return meta, false
+	}
+	// Rooms created before host keys existed can be managed by anyone
+	if meta.HostKey != "" && meta.HostKey != hostKey {
+		writeError(w, r, &Error{Status: http.StatusForbidden, Code: CodeForbidden, Message: "only the host of the room can manage it"}, "")
+		return meta, false
+	}
+	return meta, true
+}
+
+type setRoomStateBody struct {
+	State   storage.RoomState `json:"state"`
+	HostKey string            `json:"hostKey"`
+	// GameID optionally chooses the game played when finishing a room, rather than the winner of its votes
+	GameID string `json:"gameID"`
+}
+
+func (a *API) setRoomState(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	roomID := vars["roomID"]
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, r, err, "failed to read body from request")
+		return
+	}
+	var req setRoomStateBody
+	err = json.Unmarshal(body, &req)
+	if err != nil {
+		writeBadRequest(w, r, "failed to unmarshal body: "+err.Error())
+		return
+	}
+
+	meta, ok := a.checkHost(w, r, roomID, req.HostKey)
+	if !ok {
+		return
+	}
+
+	if req.State == storage.RoomStateFinished {
+		_, err = a.Storage.FinishRoom(r.Context(), roomID, req.GameID)
+	} else {
+		err = a.Storage.SetRoomState(r.Context(), roomID, req.State)
+	}
+	if err == storage.ErrInvalidTransition {
+		writeConflict(w, r, "cannot move room from "+string(meta.State)+" to "+string(req.State))
+		return
+	} else if err != nil {
+		writeError(w, r, err, "failed to set room state")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+type setRoomDeadlineBody struct {
+	Deadline time.Time `json:"deadline"`
+	HostKey  string    `json:"hostKey"`
+}
+
+func (a *API) setRoomDeadline(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	roomID := vars["roomID"]
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, r, err, "failed to read body from request")
+		return
+	}
+	var req setRoomDeadlineBody
+	err = json.Unmarshal(body, &req)
+	if err != nil {
+		writeBadRequest(w, r, "failed to unmarshal body: "+err.Error())
+		return
+	}
+
+	if _, ok := a.checkHost(w, r, roomID, req.HostKey); !ok {
+		return
+	}
+
+	err = a.Storage.SetRoomDeadline(r.Context(), roomID, req.Deadline)
+	if err == storage.ErrInvalidDeadline {
+		writeBadRequest(w, r, err.Error())
+		return
+	} else if err != nil {
+		writeError(w, r, err, "failed to set room deadline")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+type getRoundsRes struct {
+	Round      int             `json:"round"`
+	Candidates []string        `json:"candidates,omitempty"`
+	Rounds     []storage.Round `json:"rounds"`
+}
+
+func (a *API) getRounds(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	roomID := vars["roomID"]
+	meta, err := a.Storage.GetRoomMeta(r.Context(), roomID)
+	if err != nil {
+		writeError(w, r, err, "failed to get state for room")
+		return
+	}
+	rounds, err := a.Storage.GetRounds(r.Context(), roomID)
+	if err != nil {
+		writeError(w, r, err, "failed to get rounds for room")
+		return
+	}
+
+	resBody, err := json.Marshal(getRoundsRes{
+		Round:      meta.Round,
+		Candidates: meta.Candidates,
+		Rounds:     rounds,
+	})
+	if err != nil {
+		writeError(w, r, err, "failed to marshal response for get rounds")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(resBody)
+}
+
+type startRoundBody struct {
+	Size    int    `json:"size"`
+	HostKey string `json:"hostKey"`
+}
+
+func (a *API) startRound(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	roomID := vars["roomID"]
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, r, err, "failed to read body from request")
+		return
+	}
+	var req startRoundBody
+	err = json.Unmarshal(body, &req)
+	if err != nil {
+		writeBadRequest(w, r, "failed to unmarshal body: "+err.Error())
+		return
+	}
+
+	if _, ok := a.checkHost(w, r, roomID, req.HostKey); !ok {
+		return
+	}
+
+	round, err := a.Storage.StartRound(r.Context(), roomID, req.Size)
+	if err != nil {
+		writeError(w, r, err, "failed to start new round")
+		return
+	}
+	a.commitPickSeed(r.Context(), roomID)
+
+	resBody, err := json.Marshal(round)
+	if err != nil {
+		writeError(w, r, err, "failed to marshal response for new round")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(resBody)
+}
+
+type getGroupHistoryRes struct {
+	Sessions []storage.Session    `json:"sessions"`
+	Stats    storage.HistoryStats `json:"stats"`
+}
+
+func (a *API) getGroupHistory(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	groupID := vars["groupID"]
+	sessions, err := a.Storage.GetGroupHistory(r.Context(), groupID)
+	if err != nil {
+		writeError(w, r, err, "failed to get history for group")
+		return
+	}
+
+	resBody, err := json.Marshal(getGroupHistoryRes{
+		Sessions: sessions,
+		Stats:    storage.GetHistoryStats(sessions, time.Now()),
+	})
+	if err != nil {
+		writeError(w, r, err, "failed to marshal response for group history")
 		return
 	}
 
@@ -337,6 +724,21 @@ func (a *API) GetRoomInfo(w http.ResponseWriter, r *http.Request) {
 type addVotesToRoomBody struct {
 	Votes  []string `json:"votes"`
 	Vetoes []string `json:"vetoes"`
+	// Token is the one issued to the user when they first voted, which is left out on their first vote
+	Token string `json:"token"`
+}
+
+type voteRes struct {
+	// Token is needed to change the user's votes, or to see them before they're revealed
+	Token string `json:"token"`
+}
+
+// claimVoter checks the token given by a user voting in a room, issuing one if they haven't voted before
+func (a *API) claimVoter(ctx context.Context, roomID, user, token string) (string, error) {
+	if token == "" {
+		token = randString(20)
+	}
+	return a.Storage.ClaimVoter(ctx, roomID, user, token)
 }
 
 func (a *API) addVotesToRoom(w http.ResponseWriter, r *http.Request) {
@@ -345,38 +747,67 @@ func (a *API) addVotesToRoom(w http.ResponseWriter, r *http.Request) {
 	userID := vars["userID"]
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("failed to read body from request: " + err.Error()))
+		writeError(w, r, err, "failed to read body from request")
 		return
 	}
 	var votes addVotesToRoomBody
 	err = json.Unmarshal(body, &votes)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("failed to unmarshal body: " + err.Error()))
+		writeBadRequest(w, r, "failed to unmarshal body: "+err.Error())
 		return
 	}
 
-	err = a.Storage.SetUserVotes(roomID, userID, votes.Votes, votes.Vetoes)
+	token, err := a.claimVoter(r.Context(), roomID, userID, votes.Token)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("failed to write votes to storage: " + err.Error()))
+		writeError(w, r, err, "failed to check voter")
+		return
+	}
+	err = a.Storage.SetUserVotes(r.Context(), roomID, userID, votes.Votes, votes.Vetoes)
+	if err != nil {
+		writeError(w, r, err, "failed to write votes to storage")
 		return
 	}
 
+	resBody, err := json.Marshal(voteRes{token})
+	if err != nil {
+		writeError(w, r, err, "failed to marshal response for votes")
+		return
+	}
 	w.WriteHeader(http.StatusOK)
-	// TODO: notify users of new votes
+	w.Write(resBody)
+}
+
+type resetVotesBody struct {
+	HostKey string `json:"hostKey"`
 }
 
+// resetVotes clears a room's ballots, reopening voting if they'd been revealed. Only the host can reset votes.
+// As the pick made from the ballots is cleared too, a seed is committed for the pick from the new ones.
 func (a *API) resetVotes(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	roomID := vars["roomID"]
-	err := a.Storage.ResetRoomVotes(roomID)
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, r, err, "failed to read body from request")
+		return
+	}
+	var req resetVotesBody
+	err = json.Unmarshal(body, &req)
+	if err != nil {
+		writeBadRequest(w, r, "failed to unmarshal body: "+err.Error())
+		return
+	}
+
+	if _, ok := a.checkHost(w, r, roomID, req.HostKey); !ok {
+		return
+	}
+
+	err = a.Storage.ResetRoomVotes(r.Context(), roomID)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("failed to reset votes in storage: " + err.Error()))
+		writeError(w, r, err, "failed to reset votes in storage")
 		return
 	}
+	a.commitPickSeed(r.Context(), roomID)
 
 	w.WriteHeader(http.StatusOK)
 }
@@ -390,28 +821,26 @@ func (a *API) addGame(w http.ResponseWriter, r *http.Request) {
 	roomID := vars["roomID"]
 	gameID := vars["gameID"]
 	userID := vars["userID"]
+	if bggclient.IsCustomID(gameID) {
+		writeBadRequest(w, r, "custom games can't be looked up on BGG")
+		return
+	}
 
-	game, err := bggclient.GetGameInfo(gameID)
+	game, err := bggclient.GetGameInfo(r.Context(), gameID)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("Failed to get game info from BGG: " + err.Error()))
+		writeError(w, r, err, "failed to get game info from BGG")
 		return
 	}
 
-	err = a.Storage.AddGamesToRoom(roomID, userID, []bggclient.Game{game})
+	err = a.Storage.AddGamesToRoom(r.Context(), roomID, userID, []bggclient.Game{game})
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("failed to add game to room: " + err.Error()))
+		writeError(w, r, err, "failed to add game to room")
 		return
 	}
 
 	resBody, err := json.Marshal(addGameRes{game})
 	if err != nil {
-		log.Error(log.Fields{
-			"roomID": roomID,
-		}, err)
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("failed to marshal response for adding game to room: " + err.Error()))
+		writeError(w, r, err, "failed to marshal response for adding game to room")
 		return
 	}
 
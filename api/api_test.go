@@ -0,0 +1,25 @@
+package api
+
+import (
+	. "testing"
+
+	"github.com/tylerdixon/bgchooser/storage"
+)
+
+func TestRedactVotes(t *T) {
+	votes := storage.VoteResult{
+		Votes:  map[string][]string{"alice": {"1"}, "bob": {"2"}},
+		Vetoes: map[string][]string{"alice": {"3"}, "bob": {"4"}},
+	}
+
+	redacted := redactVotes(votes, "alice")
+	if len(redacted.Votes) != 1 || redacted.Votes["alice"][0] != "1" || len(redacted.Vetoes) != 1 || redacted.Vetoes["alice"][0] != "3" {
+		t.Errorf("expected only alice's ballot, got %+v", redacted)
+	}
+
+	// Callers who can't show they're a voter see no ballots at all
+	redacted = redactVotes(votes, "")
+	if len(redacted.Votes) != 0 || len(redacted.Vetoes) != 0 {
+		t.Errorf("expected no ballots, got %+v", redacted)
+	}
+}
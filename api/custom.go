@@ -0,0 +1,100 @@
+package api
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/tylerdixon/bgchooser/bggclient"
+)
+
+type customGameReq struct {
+	// User is who the game is added for, in place of the BGG user a game's collection came from
+	User        string `json:"user"`
+	Name        string `json:"name"`
+	MinPlayers  int    `json:"minPlayers"`
+	MaxPlayers  int    `json:"maxPlayers"`
+	MinPlaytime int    `json:"minPlaytime"`
+	MaxPlaytime int    `json:"maxPlaytime"`
+	Thumbnail   string `json:"thumbnail"`
+}
+
+// validate checks the request describes a playable game, defaulting the upper bounds to the lower ones
+func (req *customGameReq) validate() string {
+	req.User = strings.TrimSpace(req.User)
+	req.Name = strings.TrimSpace(req.Name)
+	if req.User == "" || req.Name == "" {
+		return "user and name are required"
+	}
+	if req.MaxPlayers == 0 {
+		req.MaxPlayers = req.MinPlayers
+	}
+	if req.MaxPlaytime == 0 {
+		req.MaxPlaytime = req.MinPlaytime
+	}
+	if req.MinPlayers < 1 || req.MaxPlayers < req.MinPlayers {
+		return "player range must be at least one player, with maxPlayers no fewer than minPlayers"
+	}
+	if req.MinPlaytime < 0 || req.MaxPlaytime < req.MinPlaytime {
+		return "playtime must not be negative, with maxPlaytime no less than minPlaytime"
+	}
+	if req.Thumbnail != "" {
+		u, err := url.Parse(req.Thumbnail)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return "thumbnail must be an http or https URL"
+		}
+	}
+	return ""
+}
+
+// addCustomGame adds a game that isn't on BGG, such as a prototype, to a room. It's given an ID prefixed
+// with bggclient.CustomIDPrefix and stored with the user's other games.
+func (a *API) addCustomGame(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	roomID := vars["roomID"]
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeBadRequest(w, r, "failed to read body: "+err.Error())
+		return
+	}
+	var req customGameReq
+	err = json.Unmarshal(body, &req)
+	if err != nil {
+		writeBadRequest(w, r, "failed to parse custom game: "+err.Error())
+		return
+	}
+	if msg := req.validate(); msg != "" {
+		writeBadRequest(w, r, msg)
+		return
+	}
+
+	game := bggclient.Game{
+		ID:        bggclient.CustomIDPrefix + randString(10),
+		Name:      req.Name,
+		Thumbnail: req.Thumbnail,
+		Info: bggclient.GameInfo{
+			MinPlayers:  req.MinPlayers,
+			MaxPlayers:  req.MaxPlayers,
+			MinPlaytime: req.MinPlaytime,
+			MaxPlaytime: req.MaxPlaytime,
+		},
+	}
+	err = a.Storage.AddGamesToRoom(r.Context(), roomID, req.User, []bggclient.Game{game})
+	if err != nil {
+		writeError(w, r, err, "failed to add custom game to room")
+		return
+	}
+
+	resBody, err := json.Marshal(addGameRes{game})
+	if err != nil {
+		writeError(w, r, err, "failed to marshal response for adding custom game to room")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(resBody)
+}
@@ -0,0 +1,47 @@
+package api
+
+import (
+	. "testing"
+)
+
+func TestCustomGameReqValidate(t *T) {
+	tests := []struct {
+		name  string
+		req   customGameReq
+		valid bool
+		// want is the request once its defaults are filled in, checked when it's valid
+		want customGameReq
+	}{
+		{
+			name:  "complete",
+			req:   customGameReq{User: " alice ", Name: " Prototype ", MinPlayers: 2, MaxPlayers: 4, MinPlaytime: 30, MaxPlaytime: 60, Thumbnail: "https://example.com/a.png"},
+			valid: true,
+			want:  customGameReq{User: "alice", Name: "Prototype", MinPlayers: 2, MaxPlayers: 4, MinPlaytime: 30, MaxPlaytime: 60, Thumbnail: "https://example.com/a.png"},
+		},
+		{
+			name:  "upper bounds default to lower ones",
+			req:   customGameReq{User: "alice", Name: "Prototype", MinPlayers: 3, MinPlaytime: 45},
+			valid: true,
+			want:  customGameReq{User: "alice", Name: "Prototype", MinPlayers: 3, MaxPlayers: 3, MinPlaytime: 45, MaxPlaytime: 45},
+		},
+		{name: "missing user", req: customGameReq{User: " ", Name: "Prototype", MinPlayers: 2}},
+		{name: "missing name", req: customGameReq{User: "alice", MinPlayers: 2}},
+		{name: "no players", req: customGameReq{User: "alice", Name: "Prototype"}},
+		{name: "fewer max players than min", req: customGameReq{User: "alice", Name: "Prototype", MinPlayers: 4, MaxPlayers: 2}},
+		{name: "negative playtime", req: customGameReq{User: "alice", Name: "Prototype", MinPlayers: 2, MinPlaytime: -10}},
+		{name: "less max playtime than min", req: customGameReq{User: "alice", Name: "Prototype", MinPlayers: 2, MinPlaytime: 60, MaxPlaytime: 30}},
+		{name: "thumbnail without http", req: customGameReq{User: "alice", Name: "Prototype", MinPlayers: 2, Thumbnail: "javascript:alert(1)"}},
+		{name: "thumbnail without host", req: customGameReq{User: "alice", Name: "Prototype", MinPlayers: 2, Thumbnail: "https://"}},
+	}
+	for _, test := range tests {
+		req := test.req
+		msg := req.validate()
+		if (msg == "") != test.valid {
+			t.Errorf("%s: expected valid to be %v, got message %q", test.name, test.valid, msg)
+			continue
+		}
+		if test.valid && req != test.want {
+			t.Errorf("%s: expected %+v, got %+v", test.name, test.want, req)
+		}
+	}
+}
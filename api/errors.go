@@ -0,0 +1,168 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/tylerdixon/bgchooser/bggclient"
+	"github.com/tylerdixon/bgchooser/chooser"
+	"github.com/tylerdixon/bgchooser/storage"
+)
+
+// ErrorCode identifies the kind of failure in an error response, so clients don't need to match on messages
+type ErrorCode string
+
+const (
+	CodeBadRequest      ErrorCode = "badRequest"
+	CodeForbidden       ErrorCode = "forbidden"
+	CodeNotFound        ErrorCode = "notFound"
+	CodeConflict        ErrorCode = "conflict"
+	CodeBggUserNotFound ErrorCode = "bggUserNotFound"
+	CodeBggGameNotFound ErrorCode = "bggGameNotFound"
+	CodeBggUnavailable  ErrorCode = "bggUnavailable"
+	CodeBggProcessing   ErrorCode = "bggProcessing"
+	CodeCanceled        ErrorCode = "canceled"
+	CodeTimeout         ErrorCode = "timeout"
+	CodeInternal        ErrorCode = "internal"
+)
+
+// bggRetryAfter is how many seconds clients are asked to wait when BGG is busy or still preparing a collection
+const bggRetryAfter = 5
+
+// statusClientClosedRequest is the non-standard status nginx uses for requests the client gave up on,
+// which keeps them from being logged and counted as failures of the server
+const statusClientClosedRequest = 499
+
+// Error is the body written for every failed request. Unexpected errors, such as those from Redis or
+// the bodies of failed BGG responses, are logged rather than included in the message.
+type Error struct {
+	Status  int       `json:"-"`
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+	// RetryAfter is how many seconds to wait before retrying, for failures that may pass on their own
+	RetryAfter int `json:"retryAfter,omitempty"`
+	// cause is the error the response was converted from, which is logged rather than returned
+	cause error
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func badRequest(message string) *Error {
+	return &Error{Status: http.StatusBadRequest, Code: CodeBadRequest, Message: message}
+}
+
+// requestErrors are the errors caused by the request rather than by something failing while serving it
+var requestErrors = map[error]*Error{
+	chooser.ErrNoPickCandidates:  {Status: http.StatusConflict, Code: CodeConflict},
+	storage.ErrGroupNotFound:     {Status: http.StatusNotFound, Code: CodeNotFound},
+	storage.ErrGroupEditClashed:  {Status: http.StatusConflict, Code: CodeConflict},
+	storage.ErrRoomNotFinished:   {Status: http.StatusConflict, Code: CodeConflict},
+	storage.ErrNoPickSeed:        {Status: http.StatusConflict, Code: CodeConflict},
+	storage.ErrRoundInProgress:   {Status: http.StatusConflict, Code: CodeConflict},
+	storage.ErrNoCandidates:      {Status: http.StatusConflict, Code: CodeConflict},
+	storage.ErrInvalidTransition: {Status: http.StatusConflict, Code: CodeConflict},
+	storage.ErrNominationsClosed: {Status: http.StatusConflict, Code: CodeConflict},
+	storage.ErrVotingClosed:      {Status: http.StatusConflict, Code: CodeConflict},
+	storage.ErrInvalidDeadline:   {Status: http.StatusBadRequest, Code: CodeBadRequest},
+	storage.ErrVoterClaimed:      {Status: http.StatusForbidden, Code: CodeForbidden},
+	storage.ErrGameNotInRoom:     {Status: http.StatusBadRequest, Code: CodeBadRequest},
+}
+
+// toError converts an error into the response describing it. message describes what failed, and is
+// used in place of the error's own message for unexpected errors.
+func toError(err error, message string) *Error {
+	if apiErr, ok := err.(*Error); ok {
+		return apiErr
+	}
+	apiErr := convertError(err, message)
+	apiErr.cause = err
+	return apiErr
+}
+
+func convertError(err error, message string) *Error {
+	cause := errors.Cause(err)
+	if apiErr, ok := requestErrors[cause]; ok {
+		return &Error{Status: apiErr.Status, Code: apiErr.Code, Message: cause.Error()}
+	}
+	switch cause {
+	case context.Canceled:
+		return &Error{Status: statusClientClosedRequest, Code: CodeCanceled, Message: message + ": request was canceled"}
+	case context.DeadlineExceeded:
+		return &Error{Status: http.StatusGatewayTimeout, Code: CodeTimeout, Message: message + ": request timed out"}
+	case bggclient.ErrUserNotFound:
+		return &Error{Status: http.StatusNotFound, Code: CodeBggUserNotFound, Message: "BGG user not found"}
+	case bggclient.ErrGameNotFound:
+		return &Error{Status: http.StatusNotFound, Code: CodeBggGameNotFound, Message: "BGG game not found"}
+	case bggclient.ErrProcessing:
+		return &Error{
+			Status:     http.StatusServiceUnavailable,
+			Code:       CodeBggProcessing,
+			Message:    message + ": BGG is still processing the request",
+			RetryAfter: bggRetryAfter,
+		}
+	}
+	switch cause := cause.(type) {
+	case *bggclient.StatusError:
+		if cause.StatusCode == http.StatusTooManyRequests || cause.StatusCode == http.StatusServiceUnavailable {
+			return &Error{
+				Status:     http.StatusServiceUnavailable,
+				Code:       CodeBggUnavailable,
+				Message:    message + ": BGG is busy",
+				RetryAfter: bggRetryAfter,
+			}
+		}
+		return &Error{Status: http.StatusBadGateway, Code: CodeBggUnavailable, Message: message + ": BGG request failed"}
+	case *url.Error:
+		if cause.Err == context.Canceled || cause.Err == context.DeadlineExceeded {
+			return convertError(cause.Err, message)
+		}
+		// Only requests to BGG are made over HTTP
+		return &Error{Status: http.StatusBadGateway, Code: CodeBggUnavailable, Message: message + ": BGG request failed"}
+	}
+	return &Error{Status: http.StatusInternalServerError, Code: CodeInternal, Message: message}
+}
+
+// writeError writes the JSON response for an error, logging it along with the route's variables if
+// it wasn't caused by the request
+func writeError(w http.ResponseWriter, r *http.Request, err error, message string) {
+	apiErr := toError(err, message)
+	if apiErr.Status >= http.StatusInternalServerError {
+		fields := log.Fields{}
+		for name, value := range mux.Vars(r) {
+			fields[name] = value
+		}
+		if apiErr.cause != nil {
+			err = apiErr.cause
+		}
+		log.Error(fields, err)
+	}
+	body, err := json.Marshal(apiErr)
+	if err != nil {
+		body = []byte(`{"code":"internal","message":"failed to marshal error"}`)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if apiErr.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(apiErr.RetryAfter))
+	}
+	w.WriteHeader(apiErr.Status)
+	w.Write(body)
+}
+
+// writeBadRequest writes the response for a request that's missing or has invalid input
+func writeBadRequest(w http.ResponseWriter, r *http.Request, message string) {
+	writeError(w, r, badRequest(message), message)
+}
+
+// writeConflict writes the response for a request the room or group isn't in a state to accept
+func writeConflict(w http.ResponseWriter, r *http.Request, message string) {
+	writeError(w, r, &Error{Status: http.StatusConflict, Code: CodeConflict, Message: message}, message)
+}
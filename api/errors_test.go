@@ -0,0 +1,115 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	. "testing"
+
+	"github.com/pkg/errors"
+	"github.com/tylerdixon/bgchooser/bggclient"
+)
+
+func TestToErrorRequestErrors(t *T) {
+	for err, want := range requestErrors {
+		apiErr := toError(errors.Wrap(err, "failed to update room"), "failed to update room")
+		if apiErr.Status != want.Status || apiErr.Code != want.Code || apiErr.Message != err.Error() {
+			t.Errorf("%v: expected %d %s with the error's message, got %+v", err, want.Status, want.Code, apiErr)
+		}
+		if apiErr.cause == nil {
+			t.Errorf("%v: expected the cause to be kept for logging", err)
+		}
+	}
+}
+
+func TestToError(t *T) {
+	tests := []struct {
+		name       string
+		err        error
+		status     int
+		code       ErrorCode
+		message    string
+		retryAfter int
+	}{
+		{
+			name:    "bgg user not found",
+			err:     errors.Wrap(bggclient.ErrUserNotFound, "failed to get collection"),
+			status:  http.StatusNotFound,
+			code:    CodeBggUserNotFound,
+			message: "BGG user not found",
+		},
+		{
+			name:       "bgg processing",
+			err:        bggclient.ErrProcessing,
+			status:     http.StatusServiceUnavailable,
+			code:       CodeBggProcessing,
+			message:    "failed to add user: BGG is still processing the request",
+			retryAfter: bggRetryAfter,
+		},
+		{
+			name:       "bgg rate limited",
+			err:        &bggclient.StatusError{StatusCode: http.StatusTooManyRequests, Body: "slow down"},
+			status:     http.StatusServiceUnavailable,
+			code:       CodeBggUnavailable,
+			message:    "failed to add user: BGG is busy",
+			retryAfter: bggRetryAfter,
+		},
+		{
+			name:       "bgg unavailable",
+			err:        &bggclient.StatusError{StatusCode: http.StatusServiceUnavailable},
+			status:     http.StatusServiceUnavailable,
+			code:       CodeBggUnavailable,
+			message:    "failed to add user: BGG is busy",
+			retryAfter: bggRetryAfter,
+		},
+		{
+			name:    "bgg failed",
+			err:     &bggclient.StatusError{StatusCode: http.StatusInternalServerError, Body: "<error>stack trace</error>"},
+			status:  http.StatusBadGateway,
+			code:    CodeBggUnavailable,
+			message: "failed to add user: BGG request failed",
+		},
+		{
+			name:    "canceled",
+			err:     errors.Wrap(context.Canceled, "failed to get games"),
+			status:  statusClientClosedRequest,
+			code:    CodeCanceled,
+			message: "failed to add user: request was canceled",
+		},
+		{
+			name:    "canceled bgg request",
+			err:     &url.Error{Op: "Get", URL: "https://boardgamegeek.com/xmlapi2/collection", Err: context.Canceled},
+			status:  statusClientClosedRequest,
+			code:    CodeCanceled,
+			message: "failed to add user: request was canceled",
+		},
+		{
+			name:    "timed out",
+			err:     context.DeadlineExceeded,
+			status:  http.StatusGatewayTimeout,
+			code:    CodeTimeout,
+			message: "failed to add user: request timed out",
+		},
+		{
+			name:    "unexpected",
+			err:     errors.New("dial tcp 10.0.0.3:6379: connection refused"),
+			status:  http.StatusInternalServerError,
+			code:    CodeInternal,
+			message: "failed to add user",
+		},
+	}
+	for _, test := range tests {
+		apiErr := toError(test.err, "failed to add user")
+		if apiErr.Status != test.status || apiErr.Code != test.code || apiErr.Message != test.message || apiErr.RetryAfter != test.retryAfter {
+			t.Errorf("%s: expected %d %s %q retrying after %d, got %+v", test.name, test.status, test.code, test.message, test.retryAfter, apiErr)
+		}
+		if apiErr.cause != test.err {
+			t.Errorf("%s: expected the cause to be kept for logging, got %v", test.name, apiErr.cause)
+		}
+	}
+
+	apiErr := badRequest("votes must be given")
+	if toError(apiErr, "failed to vote") != apiErr {
+		t.Errorf("expected an *Error to be returned as is")
+	}
+}
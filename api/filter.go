@@ -0,0 +1,78 @@
+package api
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/tylerdixon/bgchooser/bggclient"
+	"github.com/tylerdixon/bgchooser/chooser"
+)
+
+// queryList splits a comma separated query parameter, ignoring empty entries
+func queryList(query url.Values, name string) []string {
+	var list []string
+	for _, item := range strings.Split(query.Get(name), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func queryFloat(query url.Values, name string) (float64, error) {
+	param := query.Get(name)
+	if param == "" {
+		return 0, nil
+	}
+	f, err := strconv.ParseFloat(param, 64)
+	if err == nil && f < 0 {
+		err = strconv.ErrRange
+	}
+	return f, err
+}
+
+// parseGameFilter reads the query parameters used to filter and sort a room's games
+func parseGameFilter(query url.Values) (chooser.GameFilter, chooser.SortOrder, error) {
+	filter := chooser.GameFilter{
+		Owner:      query.Get("owner"),
+		Categories: queryList(query, "category"),
+		Mechanics:  queryList(query, "mechanics"),
+	}
+	var err error
+	for name, dest := range map[string]*int{"players": &filter.Players, "maxPlaytime": &filter.MaxPlaytime} {
+		*dest, err = queryInt(query, name)
+		if err != nil {
+			return filter, "", errors.New(name + " must be a positive number")
+		}
+	}
+	for name, dest := range map[string]*float64{"minWeight": &filter.MinWeight, "maxWeight": &filter.MaxWeight} {
+		*dest, err = queryFloat(query, name)
+		if err != nil {
+			return filter, "", errors.New(name + " must be a positive number")
+		}
+	}
+	if filter.MaxWeight > 0 && filter.MinWeight > filter.MaxWeight {
+		return filter, "", errors.New("minWeight must not be greater than maxWeight")
+	}
+	order := chooser.SortOrder(query.Get("sort"))
+	if order == "" {
+		order = chooser.SortAlphaAsc
+	}
+	if !chooser.ValidSortOrder(order) {
+		return filter, "", errors.New("sort must be one of alpha, alphaDesc, playtime, playtimeDesc, votes or lastPlayed")
+	}
+	return filter, order, nil
+}
+
+// gameOwners lists the users whose collections each game was added from, keyed by game ID
+func gameOwners(userGames map[string][]bggclient.Game) map[string][]string {
+	owners := make(map[string][]string)
+	for user, games := range userGames {
+		for _, game := range games {
+			owners[game.ID] = append(owners[game.ID], user)
+		}
+	}
+	return owners
+}
@@ -0,0 +1,281 @@
+package api
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/tylerdixon/bgchooser/bggclient"
+	"github.com/tylerdixon/bgchooser/storage"
+)
+
+type getGroupRes struct {
+	Group   storage.Group               `json:"group"`
+	Library map[string][]bggclient.Game `json:"library"`
+}
+
+// validateMembers checks that every member of a new group has a name, and that no two share one
+func validateMembers(members []storage.GroupMember) error {
+	names := make(map[string]bool)
+	for _, member := range members {
+		if member.Name == "" {
+			return badRequest("every member must have a name")
+		}
+		if names[member.Name] {
+			return badRequest("more than one member is named " + member.Name)
+		}
+		names[member.Name] = true
+	}
+	return nil
+}
+
+// orphanedBggUsers returns the BGG users of removed members that none of the remaining members share,
+// whose libraries are no longer needed by the group
+func orphanedBggUsers(removed, remaining []storage.GroupMember) []string {
+	kept := make(map[string]bool)
+	for _, m := range remaining {
+		kept[m.BggUser] = true
+	}
+	var orphaned []string
+	for _, m := range removed {
+		if m.BggUser != "" && !kept[m.BggUser] {
+			kept[m.BggUser] = true
+			orphaned = append(orphaned, m.BggUser)
+		}
+	}
+	return orphaned
+}
+
+func (a *API) newGroup(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, r, err, "failed to read body from request")
+		return
+	}
+	var group storage.Group
+	err = json.Unmarshal(body, &group)
+	if err != nil {
+		writeBadRequest(w, r, "failed to unmarshal body: "+err.Error())
+		return
+	}
+	err = validateMembers(group.Members)
+	if err != nil {
+		writeError(w, r, err, "invalid members for new group")
+		return
+	}
+
+	group.ID = randString(10)
+	err = a.Storage.SaveGroup(r.Context(), group)
+	if err != nil {
+		writeError(w, r, err, "failed to create group")
+		return
+	}
+
+	resBody, err := json.Marshal(group)
+	if err != nil {
+		writeError(w, r, err, "failed to marshal response for new group")
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(resBody)
+}
+
+// loadGroup retrieves a group, writing an error response if it can't be found
+func (a *API) loadGroup(w http.ResponseWriter, r *http.Request, groupID string) (storage.Group, bool) {
+	group, err := a.Storage.GetGroup(r.Context(), groupID)
+	if err != nil {
+		writeError(w, r, err, "failed to get group")
+		return group, false
+	}
+	return group, true
+}
+
+func (a *API) getGroup(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	groupID := vars["groupID"]
+	group, ok := a.loadGroup(w, r, groupID)
+	if !ok {
+		return
+	}
+	library, err := a.Storage.GetGroupLibrary(r.Context(), groupID)
+	if err != nil {
+		writeError(w, r, err, "failed to get library for group")
+		return
+	}
+
+	resBody, err := json.Marshal(getGroupRes{
+		Group:   group,
+		Library: library,
+	})
+	if err != nil {
+		writeError(w, r, err, "failed to marshal response for get group")
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(resBody)
+}
+
+func (a *API) addGroupMember(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	groupID := vars["groupID"]
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, r, err, "failed to read body from request")
+		return
+	}
+	var member storage.GroupMember
+	err = json.Unmarshal(body, &member)
+	if err != nil || member.Name == "" {
+		writeBadRequest(w, r, "body must be a member with a name")
+		return
+	}
+
+	err = a.Storage.UpdateGroup(r.Context(), groupID, func(group *storage.Group) error {
+		for _, m := range group.Members {
+			if m.Name == member.Name {
+				return &Error{Status: http.StatusConflict, Code: CodeConflict, Message: "group already has a member named " + member.Name}
+			}
+		}
+		group.Members = append(group.Members, member)
+		return nil
+	})
+	if err != nil {
+		writeError(w, r, err, "failed to save group")
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+func (a *API) removeGroupMember(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	groupID := vars["groupID"]
+	name := vars["name"]
+
+	var removed, remaining []storage.GroupMember
+	err := a.Storage.UpdateGroup(r.Context(), groupID, func(group *storage.Group) error {
+		// The edit may be retried, so only the members removed by the attempt that's saved count
+		removed = nil
+		var members []storage.GroupMember
+		for _, m := range group.Members {
+			if m.Name == name {
+				removed = append(removed, m)
+			} else {
+				members = append(members, m)
+			}
+		}
+		group.Members = members
+		remaining = members
+		return nil
+	})
+	if err != nil {
+		writeError(w, r, err, "failed to save group")
+		return
+	}
+
+	// Libraries are cached by BGG user, so one is kept while any remaining member shares it
+	for _, bggUser := range orphanedBggUsers(removed, remaining) {
+		err := a.Storage.RemoveGroupLibrary(r.Context(), groupID, bggUser)
+		if err != nil {
+			writeError(w, r, err, "failed to remove member's games from library")
+			return
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// refreshLibrary fetches the BGG collections of a group's members into its cached library. Unless
+// force is set, only members whose collection isn't cached yet are fetched.
+func (a *API) refreshLibrary(group storage.Group, force bool, r *http.Request) (map[string][]bggclient.Game, error) {
+	library, err := a.Storage.GetGroupLibrary(r.Context(), group.ID)
+	if err != nil {
+		return library, err
+	}
+	for _, member := range group.Members {
+		if member.BggUser == "" {
+			continue
+		}
+		if _, ok := library[member.BggUser]; ok && !force {
+			continue
+		}
+		games, err := bggclient.GetUserCollection(r.Context(), member.BggUser, r.Header.Get("X-Forwarded-For"))
+		if err != nil {
+			return library, err
+		}
+		err = a.Storage.SetGroupLibrary(r.Context(), group.ID, member.BggUser, games)
+		if err != nil {
+			return library, err
+		}
+		library[member.BggUser] = games
+	}
+	return library, nil
+}
+
+func (a *API) refreshGroupLibrary(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	groupID := vars["groupID"]
+	group, ok := a.loadGroup(w, r, groupID)
+	if !ok {
+		return
+	}
+
+	library, err := a.refreshLibrary(group, true, r)
+	if err != nil {
+		writeError(w, r, err, "failed to refresh library for group")
+		return
+	}
+
+	resBody, err := json.Marshal(getGroupRes{
+		Group:   group,
+		Library: library,
+	})
+	if err != nil {
+		writeError(w, r, err, "failed to marshal response for group library")
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(resBody)
+}
+
+// newGroupRoom creates a room for a group, adding its members and the games from its library
+func (a *API) newGroupRoom(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	groupID := vars["groupID"]
+	group, ok := a.loadGroup(w, r, groupID)
+	if !ok {
+		return
+	}
+
+	library, err := a.refreshLibrary(group, false, r)
+	if err != nil {
+		writeError(w, r, err, "failed to get library for group")
+		return
+	}
+
+	res, err := a.createRoom(r.Context(), groupID)
+	if err != nil {
+		writeError(w, r, err, "failed to create room")
+		return
+	}
+	err = a.Storage.AddRoomMembers(r.Context(), res.RoomID, group.Members)
+	if err != nil {
+		writeError(w, r, err, "failed to add members to room")
+		return
+	}
+	for bggUser, games := range library {
+		err = a.Storage.AddGamesToRoom(r.Context(), res.RoomID, bggUser, games)
+		if err != nil {
+			writeError(w, r, err, "failed to add games to room")
+			return
+		}
+	}
+
+	resBody, err := json.Marshal(res)
+	if err != nil {
+		writeError(w, r, err, "failed to marshal response for new room")
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(resBody)
+}
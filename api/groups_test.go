@@ -0,0 +1,41 @@
+package api
+
+import (
+	. "testing"
+
+	"github.com/tylerdixon/bgchooser/storage"
+)
+
+func TestValidateMembers(t *T) {
+	tests := []struct {
+		members []storage.GroupMember
+		valid   bool
+	}{
+		{nil, true},
+		{[]storage.GroupMember{{Name: "Alex", BggUser: "alex42"}, {Name: "Jo"}}, true},
+		{[]storage.GroupMember{{Name: "Alex"}, {BggUser: "samplays"}}, false},
+		{[]storage.GroupMember{{Name: "Alex"}, {Name: "Alex", BggUser: "alex42"}}, false},
+	}
+	for _, test := range tests {
+		if err := validateMembers(test.members); (err == nil) != test.valid {
+			t.Errorf("expected members %+v to be valid: %v, got %v", test.members, test.valid, err)
+		}
+	}
+}
+
+func TestOrphanedBggUsers(t *T) {
+	removed := []storage.GroupMember{
+		{Name: "Alex", BggUser: "alex42"},
+		{Name: "Alex's partner", BggUser: "sharedshelf"},
+		{Name: "Jo"},
+	}
+	remaining := []storage.GroupMember{
+		{Name: "Sam", BggUser: "sharedshelf"},
+		{Name: "Riley"},
+	}
+
+	orphaned := orphanedBggUsers(removed, remaining)
+	if len(orphaned) != 1 || orphaned[0] != "alex42" {
+		t.Errorf("expected only alex42's library to be removed, got %v", orphaned)
+	}
+}
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/tylerdixon/bgchooser/bggclient"
+)
+
+// bggProbeInterval is how long BGG's reachability is remembered, so readiness checks don't add to
+// the load on BGG
+const bggProbeInterval = time.Minute
+
+// readyTimeout bounds how long a readiness check waits on redis and BGG
+const readyTimeout = 5 * time.Second
+
+// unreachable is reported in place of the error from a dependency that failed a readiness check, which is logged instead
+const unreachable = "unreachable"
+
+// bggProbe samples whether BGG can be reached
+type bggProbe struct {
+	mu       sync.Mutex
+	checked  time.Time
+	err      error
+	sampling bool
+}
+
+// check returns the result of the last sample, sampling again if it's out of date. The sample is
+// taken without the lock held, and checks made meanwhile get the previous result.
+func (p *bggProbe) check(ctx context.Context) error {
+	p.mu.Lock()
+	if p.sampling || time.Since(p.checked) <= bggProbeInterval {
+		err := p.err
+		p.mu.Unlock()
+		return err
+	}
+	p.sampling = true
+	p.mu.Unlock()
+
+	err := bggclient.Ping(ctx)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.err, p.checked, p.sampling = err, time.Now(), false
+	return err
+}
+
+type readyRes struct {
+	Redis string `json:"redis"`
+	BGG   string `json:"bgg"`
+}
+
+// healthz reports that the process is up and serving requests
+func (a *API) healthz(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("ok"))
+}
+
+// readyz reports whether the api can serve requests, which depends on reaching redis. BGG being
+// unreachable is reported but doesn't fail the check, since rooms work without it once games are added.
+func (a *API) readyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+	defer cancel()
+
+	res := readyRes{Redis: "ok", BGG: "ok"}
+	status := http.StatusOK
+	if err := a.Storage.Ping(ctx); err != nil {
+		log.Warn(log.Fields{"err": err}, "Readiness check failed to reach redis")
+		res.Redis = unreachable
+		status = http.StatusServiceUnavailable
+	}
+	if err := a.bgg.check(ctx); err != nil {
+		log.Warn(log.Fields{"err": err}, "Readiness check failed to reach BGG")
+		res.BGG = unreachable
+	}
+
+	resBody, err := json.Marshal(res)
+	if err != nil {
+		writeError(w, r, err, "failed to marshal readiness")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(resBody)
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "bgchooser",
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of API requests, by route, method and response status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+	activeSockets = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "bgchooser",
+		Subsystem: "http",
+		Name:      "websocket_connections",
+		Help:      "Room websockets currently open.",
+	})
+	slowSocketsClosed = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "bgchooser",
+		Subsystem: "http",
+		Name:      "websocket_slow_closed_total",
+		Help:      "Room websockets closed for falling too far behind on their messages.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(requestDuration, activeSockets, slowSocketsClosed)
+}
+
+// observeRequest records the latency of a request against the template of the route it matched, so
+// that rooms and groups don't each get their own series
+func observeRequest(r *http.Request, status int, took time.Duration) {
+	route := "unmatched"
+	if current := mux.CurrentRoute(r); current != nil {
+		if template, err := current.GetPathTemplate(); err == nil {
+			route = template
+		}
+	}
+	requestDuration.WithLabelValues(route, r.Method, strconv.Itoa(status)).Observe(took.Seconds())
+}
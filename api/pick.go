@@ -0,0 +1,158 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/gorilla/mux"
+	"github.com/tylerdixon/bgchooser/chooser"
+	"github.com/tylerdixon/bgchooser/storage"
+)
+
+type pickRes struct {
+	chooser.PickResult
+	// NextCommitment is committed to for the room's following pick
+	NextCommitment string `json:"nextCommitment"`
+}
+
+func newSeed() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	return hex.EncodeToString(b), err
+}
+
+// pickCommitment returns the commitment to a room's next random pick, committing to a new seed if needed.
+// Seeds are committed when rooms are created, rounds are started and picks are made, rather than
+// when a room is read, so that looking up a room never writes to it.
+func (a *API) pickCommitment(ctx context.Context, roomID string) (string, error) {
+	seed, err := newSeed()
+	if err != nil {
+		return "", err
+	}
+	seed, err = a.Storage.EnsurePickSeed(ctx, roomID, seed)
+	if err != nil {
+		return "", err
+	}
+	return chooser.Commitment(seed), nil
+}
+
+// commitPickSeed commits to a seed for a room's next random pick, logging rather than failing if it
+// can't. A room without a seed is given one the next time a pick is attempted.
+func (a *API) commitPickSeed(ctx context.Context, roomID string) {
+	_, err := a.pickCommitment(ctx, roomID)
+	if err != nil {
+		log.Warn(log.Fields{"roomID": roomID, "err": err}, "Failed to commit to seed for next pick")
+	}
+}
+
+type pickGameBody struct {
+	HostKey string `json:"hostKey"`
+}
+
+// pickGame randomly picks one of the room's games for the number of players given by the `players`
+// query parameter. The hash of the seed for the pick is shown in the room's info beforehand, and the
+// seed is revealed in the result broadcast to the room so anyone can verify the pick. Only the host
+// can pick, and only once a round, so a pick can't be redrawn until it comes out a particular way;
+// picking again in the same round returns the original pick.
+func (a *API) pickGame(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	roomID := vars["roomID"]
+	players, err := queryInt(r.URL.Query(), "players")
+	if err != nil {
+		writeBadRequest(w, r, "players must be a positive number")
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, r, err, "failed to read body from request")
+		return
+	}
+	var req pickGameBody
+	err = json.Unmarshal(body, &req)
+	if err != nil {
+		writeBadRequest(w, r, "failed to unmarshal body: "+err.Error())
+		return
+	}
+
+	meta, ok := a.checkHost(w, r, roomID, req.HostKey)
+	if !ok {
+		return
+	}
+	if meta.Pick != nil {
+		writePick(w, meta.Pick)
+		return
+	}
+
+	votes, ok := a.revealedVotes(w, r, roomID)
+	if !ok {
+		return
+	}
+	games, err := a.Storage.GetGamesForRoom(r.Context(), roomID)
+	if err != nil {
+		writeError(w, r, err, "failed to get games for room")
+		return
+	}
+
+	seed, err := a.Storage.TakePickSeed(r.Context(), roomID)
+	if err == storage.ErrNoPickSeed {
+		// Commit to a seed now, so the pick can be made once its commitment has been seen
+		a.commitPickSeed(r.Context(), roomID)
+	}
+	if err != nil {
+		writeError(w, r, err, "failed to get seed for pick")
+		return
+	}
+
+	var res pickRes
+	res.PickResult, err = chooser.Pick(games, votes.Tally(), meta.Candidates, players, seed)
+	if err == chooser.ErrNoPickCandidates {
+		// The seed was never used, so it is committed to again
+		_, seedErr := a.Storage.EnsurePickSeed(r.Context(), roomID, seed)
+		if seedErr != nil {
+			log.Warn(log.Fields{"roomID": roomID, "err": seedErr}, "Failed to recommit to unused seed")
+		}
+	}
+	if err != nil {
+		writeError(w, r, err, "failed to pick game")
+		return
+	}
+	res.NextCommitment, err = a.pickCommitment(r.Context(), roomID)
+	if err != nil {
+		log.Warn(log.Fields{"roomID": roomID, "err": err}, "Failed to commit to seed for next pick")
+	}
+
+	resBody, err := json.Marshal(res)
+	if err != nil {
+		writeError(w, r, err, "failed to marshal response for pick")
+		return
+	}
+	stored, saved, err := a.Storage.SavePick(r.Context(), roomID, resBody)
+	if err != nil {
+		writeError(w, r, err, "failed to save pick for room")
+		return
+	}
+	// Another pick was saved for the round first, so that's the round's pick instead
+	if !saved {
+		writePick(w, stored)
+		return
+	}
+
+	err = a.Storage.PublishPick(r.Context(), roomID, res)
+	if err != nil {
+		writeError(w, r, err, "failed to broadcast pick to room")
+		return
+	}
+
+	writePick(w, resBody)
+}
+
+func writePick(w http.ResponseWriter, pick json.RawMessage) {
+	w.WriteHeader(http.StatusOK)
+	w.Write(pick)
+}
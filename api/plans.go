@@ -0,0 +1,74 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/tylerdixon/bgchooser/chooser"
+	"github.com/tylerdixon/bgchooser/storage"
+)
+
+// defaultPlans is how many plans are returned when no limit is given
+const defaultPlans = 5
+
+// revealedVotes retrieves a room's votes, writing an error response if they haven't been revealed yet,
+// since anything computed from them would give away the hidden ballots
+func (a *API) revealedVotes(w http.ResponseWriter, r *http.Request, roomID string) (storage.VoteResult, bool) {
+	meta, err := a.Storage.GetRoomMeta(r.Context(), roomID)
+	if err != nil {
+		writeError(w, r, err, "failed to get state for room")
+		return storage.VoteResult{}, false
+	}
+	if meta.State != storage.RoomStateRevealed && meta.State != storage.RoomStateFinished {
+		writeConflict(w, r, "the room's votes have not been revealed yet")
+		return storage.VoteResult{}, false
+	}
+	votes, err := a.Storage.GetUserVotes(r.Context(), roomID)
+	if err != nil {
+		writeError(w, r, err, "failed to get votes for room")
+		return votes, false
+	}
+	return votes, true
+}
+
+// getPlans returns the combinations of games that fit in the number of minutes given by the `time`
+// query parameter, favouring the games with the most votes
+func (a *API) getPlans(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	roomID := vars["roomID"]
+	var opts chooser.PlanOptions
+	var err error
+	for name, dest := range map[string]*int{"players": &opts.Players, "time": &opts.Minutes, "limit": &opts.Limit} {
+		*dest, err = queryInt(r.URL.Query(), name)
+		if err != nil {
+			writeBadRequest(w, r, name+" must be a positive number")
+			return
+		}
+	}
+	if opts.Minutes == 0 {
+		writeBadRequest(w, r, "time must be given as the number of minutes available")
+		return
+	}
+	if opts.Limit == 0 {
+		opts.Limit = defaultPlans
+	}
+
+	votes, ok := a.revealedVotes(w, r, roomID)
+	if !ok {
+		return
+	}
+	games, err := a.Storage.GetGamesForRoom(r.Context(), roomID)
+	if err != nil {
+		writeError(w, r, err, "failed to get games for room")
+		return
+	}
+
+	resBody, err := json.Marshal(chooser.PlanEvening(games, votes.Tally(), opts))
+	if err != nil {
+		writeError(w, r, err, "failed to marshal response for plans")
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(resBody)
+}
@@ -0,0 +1,165 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/gorilla/mux"
+	"github.com/tylerdixon/bgchooser/bggclient"
+	"github.com/tylerdixon/bgchooser/storage"
+)
+
+// playHistoryWindow is how far back plays are fetched from BGG when summarizing what a room has played
+const playHistoryWindow = time.Hour * 24 * 365 * 2
+
+// playsFetchTimeout bounds fetching all the pages of a user's plays in the background
+const playsFetchTimeout = time.Minute * 2
+
+// playsFetcher fetches users' plays from BGG into the cache off the request path, fetching each user
+// at most once at a time
+type playsFetcher struct {
+	stor     storage.Storage
+	mu       sync.Mutex
+	fetching map[string]bool
+}
+
+func newPlaysFetcher(stor storage.Storage) *playsFetcher {
+	return &playsFetcher{stor: stor, fetching: make(map[string]bool)}
+}
+
+// fetch starts caching the plays of a BGG user, unless they're already being fetched
+func (f *playsFetcher) fetch(bggUser string) {
+	f.mu.Lock()
+	if f.fetching[bggUser] {
+		f.mu.Unlock()
+		return
+	}
+	f.fetching[bggUser] = true
+	f.mu.Unlock()
+
+	go func() {
+		defer func() {
+			f.mu.Lock()
+			delete(f.fetching, bggUser)
+			f.mu.Unlock()
+		}()
+		ctx, cancel := context.WithTimeout(context.Background(), playsFetchTimeout)
+		defer cancel()
+		plays, err := bggclient.GetUserPlays(ctx, bggUser, time.Now().Add(-playHistoryWindow))
+		if err != nil {
+			log.Warn(log.Fields{"bggUser": bggUser, "err": err}, "Failed to get plays for user")
+			return
+		}
+		err = f.stor.SetUserPlays(ctx, bggUser, plays)
+		if err != nil {
+			log.Warn(log.Fields{"bggUser": bggUser, "err": err}, "Failed to cache plays for user")
+		}
+	}()
+}
+
+// roomPlayStats summarizes the plays logged on BGG by the room's BGG users, using only plays that are
+// already cached. Users whose plays aren't cached are fetched in the background, and are counted once
+// the room is next loaded. Users without plays, such as members who added games without a BGG account,
+// are skipped.
+func (a *API) roomPlayStats(ctx context.Context, roomID string) (map[string]bggclient.PlayStats, error) {
+	bggUsers, err := a.Storage.GetRoomBggUsers(ctx, roomID)
+	if err != nil {
+		return nil, err
+	}
+	userPlays := make(map[string][]bggclient.Play)
+	for _, bggUser := range bggUsers {
+		plays, ok, err := a.Storage.GetUserPlays(ctx, bggUser)
+		if err != nil {
+			log.Warn(log.Fields{"bggUser": bggUser, "err": err}, "Failed to get cached plays for user")
+			continue
+		}
+		if !ok {
+			a.plays.fetch(bggUser)
+			continue
+		}
+		userPlays[bggUser] = plays
+	}
+	return bggclient.SummarizePlays(userPlays), nil
+}
+
+// sessionPlays converts a finished session into the play-log records BGG expects, using the BGG
+// usernames of any members added from the room's group. Custom games are logged by name only.
+func sessionPlays(session storage.Session, members []storage.GroupMember) bggclient.Plays {
+	bggUsers := make(map[string]string)
+	for _, member := range members {
+		bggUsers[member.Name] = member.BggUser
+	}
+	play := bggclient.Play{
+		Date:     session.Date.Format(bggclient.PlayDateFormat),
+		Quantity: 1,
+		Item: bggclient.PlayItem{
+			Name:       session.GameNames[session.Winner],
+			ObjectType: "thing",
+			ObjectID:   session.Winner,
+		},
+	}
+	if bggclient.IsCustomID(session.Winner) {
+		play.Item.ObjectID = ""
+	}
+	for _, attendee := range session.Attendees {
+		play.Players = append(play.Players, bggclient.PlayPlayer{
+			Name:     attendee,
+			Username: bggUsers[attendee],
+		})
+	}
+	return bggclient.Plays{
+		Total: 1,
+		Page:  1,
+		Plays: []bggclient.Play{play},
+	}
+}
+
+// exportPlays writes the game a room chose as BGG play-log records, either as XML or, when the
+// `format` query parameter is `csv`, as CSV
+func (a *API) exportPlays(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	roomID := vars["roomID"]
+	session, err := a.Storage.GetRoomSession(r.Context(), roomID)
+	if err != nil {
+		writeError(w, r, err, "failed to get session for room")
+		return
+	}
+	if session.Winner == "" {
+		writeConflict(w, r, "room finished without choosing a game")
+		return
+	}
+	members, err := a.Storage.GetRoomMembers(r.Context(), roomID)
+	if err != nil {
+		writeError(w, r, err, "failed to get members for room")
+		return
+	}
+
+	plays := sessionPlays(session, members)
+	var buf bytes.Buffer
+	var contentType, filename string
+	switch r.URL.Query().Get("format") {
+	case "", "xml":
+		contentType, filename = "application/xml", "plays.xml"
+		err = bggclient.EncodePlaysXML(&buf, plays)
+	case "csv":
+		contentType, filename = "text/csv", "plays.csv"
+		err = bggclient.EncodePlaysCSV(&buf, plays)
+	default:
+		writeBadRequest(w, r, "format must be either xml or csv")
+		return
+	}
+	if err != nil {
+		writeError(w, r, err, "failed to encode plays")
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", "attachment; filename=\""+roomID+"-"+filename+"\"")
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
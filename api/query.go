@@ -0,0 +1,19 @@
+package api
+
+import (
+	"net/url"
+	"strconv"
+)
+
+// queryInt reads an optional, non-negative integer query parameter, returning 0 if it isn't set
+func queryInt(query url.Values, name string) (int, error) {
+	param := query.Get(name)
+	if param == "" {
+		return 0, nil
+	}
+	i, err := strconv.Atoi(param)
+	if err == nil && i < 0 {
+		err = strconv.ErrRange
+	}
+	return i, err
+}
@@ -0,0 +1,146 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/gorilla/mux"
+	"github.com/tylerdixon/bgchooser/bggclient"
+	"github.com/tylerdixon/bgchooser/chooser"
+	"github.com/tylerdixon/bgchooser/storage"
+)
+
+// defaultRecommendations is how many recommendations are returned when no limit is given
+const defaultRecommendations = 10
+
+// gameDetails retrieves the community statistics for a set of games, only fetching from BGG the games that aren't cached.
+// Custom games have no statistics.
+func (a *API) gameDetails(ctx context.Context, games []bggclient.Game) (map[string]bggclient.GameDetails, error) {
+	seen := make(map[string]bool)
+	var gameIDs []string
+	for _, game := range games {
+		if !seen[game.ID] && !bggclient.IsCustomID(game.ID) {
+			seen[game.ID] = true
+			gameIDs = append(gameIDs, game.ID)
+		}
+	}
+	details, err := a.Storage.GetGameDetails(ctx, gameIDs)
+	if err != nil {
+		return details, err
+	}
+
+	var missing []string
+	for _, gameID := range gameIDs {
+		if _, ok := details[gameID]; !ok {
+			missing = append(missing, gameID)
+		}
+	}
+	if len(missing) == 0 {
+		return details, nil
+	}
+	fetched, err := bggclient.GetGameDetails(ctx, missing)
+	if err != nil {
+		return details, err
+	}
+	err = a.Storage.SetGameDetails(ctx, fetched)
+	if err != nil {
+		log.Warn(log.Fields{"err": err}, "Failed to cache game details")
+	}
+	for gameID, d := range fetched {
+		details[gameID] = d
+	}
+	return details, nil
+}
+
+// memberBggUsers maps the names of the members present to the users their ratings are stored under.
+// Members added from a group are rated as their BGG user, while anyone else is rated under their name.
+func memberBggUsers(names []string, roomMembers []storage.GroupMember) []string {
+	bggUsers := make(map[string]string)
+	for _, member := range roomMembers {
+		if member.BggUser != "" {
+			bggUsers[member.Name] = member.BggUser
+		}
+	}
+	users := make([]string, 0, len(names))
+	for _, name := range names {
+		if bggUser, ok := bggUsers[name]; ok {
+			users = append(users, bggUser)
+		} else {
+			users = append(users, name)
+		}
+	}
+	return users
+}
+
+// memberNames maps the BGG users that room members' ratings are stored under back to their names
+func memberNames(roomMembers []storage.GroupMember) map[string]string {
+	names := make(map[string]string)
+	for _, member := range roomMembers {
+		if member.BggUser != "" {
+			names[member.BggUser] = member.Name
+		}
+	}
+	return names
+}
+
+// getRecommendations suggests games for the members present, given by the comma separated `members`
+// query parameter, using the `players` and `time` (in minutes) query parameters to rule out games that
+// don't fit. The player count defaults to the number of members present.
+func (a *API) getRecommendations(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	roomID := vars["roomID"]
+	var opts chooser.RecommendOptions
+	var err error
+	for name, dest := range map[string]*int{"players": &opts.Players, "time": &opts.Minutes, "limit": &opts.Limit} {
+		*dest, err = queryInt(r.URL.Query(), name)
+		if err != nil {
+			writeBadRequest(w, r, name+" must be a positive number")
+			return
+		}
+	}
+	if members := r.URL.Query().Get("members"); members != "" {
+		opts.Members = strings.Split(members, ",")
+	}
+	if opts.Players == 0 {
+		opts.Players = len(opts.Members)
+	}
+	if opts.Limit == 0 {
+		opts.Limit = defaultRecommendations
+	}
+	roomMembers, err := a.Storage.GetRoomMembers(r.Context(), roomID)
+	if err != nil {
+		writeError(w, r, err, "failed to get members of room")
+		return
+	}
+	opts.Members = memberBggUsers(opts.Members, roomMembers)
+	opts.Names = memberNames(roomMembers)
+
+	games, err := a.Storage.GetGamesForRoom(r.Context(), roomID)
+	if err != nil {
+		writeError(w, r, err, "failed to get games for room")
+		return
+	}
+	userGames, err := a.Storage.GetUserGamesForRoom(r.Context(), roomID)
+	if err != nil {
+		writeError(w, r, err, "failed to get ratings for room")
+		return
+	}
+	details, err := a.gameDetails(r.Context(), games)
+	if err != nil {
+		writeError(w, r, err, "failed to get game details from BGG")
+		return
+	}
+
+	recommendations := chooser.Recommend(games, details, storage.GetGroupRatings(userGames), opts)
+	resBody, err := json.Marshal(recommendations)
+	if err != nil {
+		writeError(w, r, err, "failed to marshal response for recommendations")
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(resBody)
+}
@@ -0,0 +1,31 @@
+package api
+
+import (
+	. "testing"
+
+	"github.com/tylerdixon/bgchooser/storage"
+)
+
+func TestMemberBggUsers(t *T) {
+	roomMembers := []storage.GroupMember{
+		{Name: "Alex", BggUser: "alex42"},
+		{Name: "Sam", BggUser: "samplays"},
+		{Name: "Jo"},
+	}
+
+	users := memberBggUsers([]string{"Alex", "Jo", "riley"}, roomMembers)
+	expected := []string{"alex42", "Jo", "riley"}
+	if len(users) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, users)
+	}
+	for i, user := range expected {
+		if users[i] != user {
+			t.Errorf("expected member %d to be rated as %s, got %s", i, user, users[i])
+		}
+	}
+
+	names := memberNames(roomMembers)
+	if len(names) != 2 || names["alex42"] != "Alex" || names["samplays"] != "Sam" {
+		t.Errorf("expected BGG users to map back to Alex and Sam, got %v", names)
+	}
+}
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"sync"
+
+	"github.com/tylerdixon/bgchooser/storage"
+)
+
+// subscribeFunc subscribes to a room's updates, returning once the subscription is confirmed, as
+// storage.Storage.SubscribeToRoomInfo does
+type subscribeFunc func(roomID string, watchFn func(storage.RoomSubscriptionMessage)) func() error
+
+// roomHub shares a single storage subscription per room between every websocket on the server that's
+// subscribed to it. A room's subscription is opened for its first listener and closed after its last.
+type roomHub struct {
+	subscribe subscribeFunc
+	mu        sync.Mutex
+	rooms     map[string]*hubRoom
+}
+
+// hubRoom is a room's shared subscription and the listeners its updates are dispatched to
+type hubRoom struct {
+	listeners map[*hubListener]bool
+	// ready is closed once the subscription is open, after which unsubscribe is set
+	ready       chan struct{}
+	unsubscribe func() error
+}
+
+type hubListener struct {
+	watchFn func(storage.RoomSubscriptionMessage)
+}
+
+func newRoomHub(subscribe subscribeFunc) *roomHub {
+	return &roomHub{subscribe: subscribe, rooms: make(map[string]*hubRoom)}
+}
+
+// add calls watchFn with each of a room's updates until the returned function is called. watchFn is
+// called from the subscription's goroutine, so it mustn't block. add returns once the room's
+// subscription is confirmed, so no update published afterwards is missed, barring a subscription that
+// takes too long to confirm; clients catch up on those through the room's sequence numbers. The
+// subscription is opened without the hub locked, so a slow one doesn't hold up the updates of other rooms.
+func (h *roomHub) add(roomID string, watchFn func(storage.RoomSubscriptionMessage)) func() error {
+	h.mu.Lock()
+	room, ok := h.rooms[roomID]
+	if !ok {
+		room = &hubRoom{listeners: make(map[*hubListener]bool), ready: make(chan struct{})}
+		h.rooms[roomID] = room
+	}
+	listener := &hubListener{watchFn}
+	room.listeners[listener] = true
+	h.mu.Unlock()
+
+	if ok {
+		<-room.ready
+	} else {
+		room.unsubscribe = h.subscribe(roomID, func(msg storage.RoomSubscriptionMessage) {
+			h.dispatch(room, msg)
+		})
+		close(room.ready)
+	}
+
+	var once sync.Once
+	var err error
+	return func() error {
+		once.Do(func() { err = h.remove(roomID, room, listener) })
+		return err
+	}
+}
+
+// remove stops dispatching a room's updates to a listener, closing the room's subscription if it was the last
+func (h *roomHub) remove(roomID string, room *hubRoom, listener *hubListener) error {
+	h.mu.Lock()
+	delete(room.listeners, listener)
+	last := len(room.listeners) == 0
+	if last {
+		delete(h.rooms, roomID)
+	}
+	h.mu.Unlock()
+
+	if !last {
+		return nil
+	}
+	<-room.ready
+	return room.unsubscribe()
+}
+
+func (h *roomHub) dispatch(room *hubRoom, msg storage.RoomSubscriptionMessage) {
+	h.mu.Lock()
+	listeners := make([]*hubListener, 0, len(room.listeners))
+	for listener := range room.listeners {
+		listeners = append(listeners, listener)
+	}
+	h.mu.Unlock()
+	for _, listener := range listeners {
+		listener.watchFn(msg)
+	}
+}
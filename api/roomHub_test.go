@@ -0,0 +1,169 @@
+package api
+
+import (
+	"sync"
+	. "testing"
+	"time"
+
+	"github.com/tylerdixon/bgchooser/storage"
+)
+
+// fakeSubscriptions stands in for storage's room subscriptions, counting how many are open
+type fakeSubscriptions struct {
+	mu       sync.Mutex
+	open     map[string]int
+	watchFns map[string]func(storage.RoomSubscriptionMessage)
+}
+
+func newFakeSubscriptions() *fakeSubscriptions {
+	return &fakeSubscriptions{open: make(map[string]int), watchFns: make(map[string]func(storage.RoomSubscriptionMessage))}
+}
+
+func (f *fakeSubscriptions) subscribe(roomID string, watchFn func(storage.RoomSubscriptionMessage)) func() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.open[roomID]++
+	f.watchFns[roomID] = watchFn
+	return func() error {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.open[roomID]--
+		return nil
+	}
+}
+
+func (f *fakeSubscriptions) count(roomID string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.open[roomID]
+}
+
+func (f *fakeSubscriptions) publish(roomID string, msg storage.RoomSubscriptionMessage) {
+	f.mu.Lock()
+	watchFn := f.watchFns[roomID]
+	f.mu.Unlock()
+	watchFn(msg)
+}
+
+func TestRoomHubSharesSubscriptions(t *T) {
+	subs := newFakeSubscriptions()
+	hub := newRoomHub(subs.subscribe)
+
+	var mu sync.Mutex
+	received := make(map[string]int)
+	listen := func(name string) func(storage.RoomSubscriptionMessage) {
+		return func(storage.RoomSubscriptionMessage) {
+			mu.Lock()
+			defer mu.Unlock()
+			received[name]++
+		}
+	}
+	removeA := hub.add("room1", listen("a"))
+	removeB := hub.add("room1", listen("b"))
+	removeC := hub.add("room2", listen("c"))
+	if subs.count("room1") != 1 || subs.count("room2") != 1 {
+		t.Fatalf("expected one subscription per room, got %v", subs.open)
+	}
+
+	subs.publish("room1", storage.RoomSubscriptionMessage{Type: storage.UpdateTypeResetVotes})
+	if received["a"] != 1 || received["b"] != 1 || received["c"] != 0 {
+		t.Errorf("expected the update to reach only room1's listeners, got %v", received)
+	}
+
+	removeA()
+	removeA()
+	if subs.count("room1") != 1 {
+		t.Errorf("expected room1's subscription to stay open for its remaining listener")
+	}
+	subs.publish("room1", storage.RoomSubscriptionMessage{Type: storage.UpdateTypeResetVotes})
+	if received["a"] != 1 || received["b"] != 2 {
+		t.Errorf("expected a removed listener to stop receiving updates, got %v", received)
+	}
+
+	removeB()
+	removeC()
+	if subs.count("room1") != 0 || subs.count("room2") != 0 {
+		t.Errorf("expected subscriptions to close with their last listener, got %v", subs.open)
+	}
+
+	hub.add("room1", listen("a"))
+	if subs.count("room1") != 1 {
+		t.Errorf("expected a room to be subscribed to again for a new listener")
+	}
+}
+
+func TestRoomHubConcurrentListeners(t *T) {
+	subs := newFakeSubscriptions()
+	hub := newRoomHub(subs.subscribe)
+	hold := hub.add("room", func(storage.RoomSubscriptionMessage) {})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			remove := hub.add("room", func(storage.RoomSubscriptionMessage) {})
+			remove()
+		}()
+		go func() {
+			defer wg.Done()
+			subs.publish("room", storage.RoomSubscriptionMessage{Type: storage.UpdateTypeResetVotes})
+		}()
+	}
+	wg.Wait()
+
+	if subs.count("room") != 1 {
+		t.Errorf("expected a single subscription while a listener remains, got %d", subs.count("room"))
+	}
+	hold()
+	if subs.count("room") != 0 {
+		t.Errorf("expected the subscription to close with its last listener, got %d", subs.count("room"))
+	}
+}
+
+func TestRoomHubSlowSubscribe(t *T) {
+	subs := newFakeSubscriptions()
+	unblock := make(chan struct{})
+	hub := newRoomHub(func(roomID string, watchFn func(storage.RoomSubscriptionMessage)) func() error {
+		if roomID == "slow" {
+			<-unblock
+		}
+		return subs.subscribe(roomID, watchFn)
+	})
+
+	received := make(chan string, 2)
+	hub.add("fast", func(storage.RoomSubscriptionMessage) { received <- "fast" })
+	slowAdded := make(chan struct{})
+	go func() {
+		hub.add("slow", func(storage.RoomSubscriptionMessage) { received <- "slow" })
+		close(slowAdded)
+	}()
+	waitFor(t, func() bool {
+		hub.mu.Lock()
+		defer hub.mu.Unlock()
+		return hub.rooms["slow"] != nil
+	}, "the slow room to start subscribing")
+
+	// The fast room's updates keep flowing while the slow room's subscription is being opened
+	done := make(chan struct{})
+	go func() {
+		subs.publish("fast", storage.RoomSubscriptionMessage{Type: storage.UpdateTypeResetVotes})
+		hub.add("fast", func(storage.RoomSubscriptionMessage) {})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected the fast room not to wait on the slow room's subscription")
+	}
+	if got := <-received; got != "fast" {
+		t.Errorf("expected the fast room's update, got %s", got)
+	}
+
+	close(unblock)
+	<-slowAdded
+	subs.publish("slow", storage.RoomSubscriptionMessage{Type: storage.UpdateTypeResetVotes})
+	if got := <-received; got != "slow" {
+		t.Errorf("expected the slow room's update once subscribed, got %s", got)
+	}
+}
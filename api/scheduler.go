@@ -0,0 +1,39 @@
+package api
+
+import (
+	"context"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// deadlinePollInterval is how often storage is checked for voting deadlines that have passed
+const deadlinePollInterval = time.Second
+
+// closeDueRounds periodically closes the voting rounds whose deadlines have passed. Deadlines are
+// read back from storage on every poll, so rounds that expired while the server was down are
+// closed as soon as it starts again. Polling stops once the context is cancelled.
+func (a *API) closeDueRounds(ctx context.Context) {
+	ticker := time.NewTicker(deadlinePollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		roomIDs, err := a.Storage.GetDueDeadlines(ctx, time.Now())
+		if err != nil {
+			log.Warn(log.Fields{"err": err}, "Failed to get due voting deadlines")
+			continue
+		}
+		for _, roomID := range roomIDs {
+			winner, closed, err := a.Storage.CloseRound(ctx, roomID)
+			if err != nil {
+				log.Error(log.Fields{"roomID": roomID, "err": err}, "Failed to close voting round")
+			} else if closed {
+				log.Info(log.Fields{"roomID": roomID, "winner": winner}, "Voting round closed")
+			}
+		}
+	}
+}
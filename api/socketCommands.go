@@ -0,0 +1,205 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/url"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/tylerdixon/bgchooser/bggclient"
+)
+
+// SocketCommandType is the kind of request a client sends over a room websocket
+type SocketCommandType string
+
+const (
+	// SocketSubscribe starts forwarding a room's updates to the websocket, acked with a snapshot of the
+	// room. If a user is given, the websocket counts towards them being online in the room. A client resubscribing after reconnecting can instead give the sequence number of the last
+	// update it saw, to have the updates it missed resent before the ack.
+	SocketSubscribe SocketCommandType = "subscribe"
+	// SocketUnsubscribe stops forwarding a room's updates to the websocket
+	SocketUnsubscribe SocketCommandType = "unsubscribe"
+	// SocketVote replaces a user's votes and vetoes in a room, acked with the token needed to vote as
+	// the user again or see their votes before they're revealed
+	SocketVote SocketCommandType = "vote"
+	// SocketAddGames adds games to a room for a user, either given in full or as BGG IDs to look up
+	SocketAddGames SocketCommandType = "addGames"
+	// SocketSnapshot returns a room's info, as GetRoomInfo does
+	SocketSnapshot SocketCommandType = "snapshot"
+)
+
+// SocketCommand is a request sent by a client over a room websocket. Each command is answered with a
+// SocketReply carrying the same ID.
+type SocketCommand struct {
+	ID      string            `json:"id"`
+	Type    SocketCommandType `json:"type"`
+	RoomID  string            `json:"roomID"`
+	User    string            `json:"user,omitempty"`
+	Votes   []string          `json:"votes,omitempty"`
+	Vetoes  []string          `json:"vetoes,omitempty"`
+	Games   []bggclient.Game  `json:"games,omitempty"`
+	GameIDs []string          `json:"gameIDs,omitempty"`
+	// Token is the one issued to the user when they first voted in the room
+	Token string `json:"token,omitempty"`
+	// LastSeq is the sequence number of the last update a resubscribing client saw
+	LastSeq int64 `json:"lastSeq,omitempty"`
+	// Query holds the query parameters GetRoomInfo takes, for subscribe and snapshot commands
+	Query map[string]string `json:"query,omitempty"`
+
+	// legacy is set for the "register:<roomID>" message clients sent before commands were JSON
+	legacy bool
+}
+
+// SocketReplyType says whether a command succeeded
+type SocketReplyType string
+
+const (
+	// SocketReplyAck is sent when a command succeeds, with any result in its data
+	SocketReplyAck SocketReplyType = "ack"
+	// SocketReplyError is sent when a command fails
+	SocketReplyError SocketReplyType = "error"
+)
+
+// SocketReply answers a SocketCommand. Its type never clashes with the types of room updates, which
+// are sent over the same websocket.
+type SocketReply struct {
+	Type  SocketReplyType `json:"type"`
+	ID    string          `json:"id,omitempty"`
+	Data  interface{}     `json:"data,omitempty"`
+	Error *Error          `json:"error,omitempty"`
+}
+
+type addGamesReply struct {
+	Games []bggclient.Game `json:"games"`
+}
+
+// parseSocketCommand parses a command, treating the original "register:<roomID>" message as a subscribe
+func parseSocketCommand(message []byte) (SocketCommand, error) {
+	var cmd SocketCommand
+	if !bytes.HasPrefix(bytes.TrimSpace(message), []byte("{")) {
+		splitMsg := strings.Split(string(message), ":")
+		if len(splitMsg) < 2 || splitMsg[1] == "" {
+			return cmd, badRequest("commands must be JSON objects")
+		}
+		return SocketCommand{Type: SocketSubscribe, RoomID: splitMsg[1], legacy: true}, nil
+	}
+	err := json.Unmarshal(message, &cmd)
+	if err != nil {
+		return cmd, badRequest("failed to unmarshal command: " + err.Error())
+	}
+	return cmd, nil
+}
+
+// runSocketCommand carries out a command for a websocket, returning the data to ack it with
+func (api *API) runSocketCommand(ctx context.Context, client *socketClient, cmd SocketCommand) (interface{}, error) {
+	if cmd.RoomID == "" {
+		return nil, badRequest("roomID must be given")
+	}
+	switch cmd.Type {
+	case SocketSubscribe:
+		// Subscribing before taking the snapshot means no update published in between is missed
+		if client.subscribe(api.hub, cmd.RoomID, cmd.User) && cmd.User != "" {
+			err := api.Storage.JoinRoom(ctx, cmd.RoomID, cmd.User, client.id)
+			if err != nil {
+				log.Warn(log.Fields{"roomID": cmd.RoomID, "user": cmd.User, "err": err}, "Failed to join room")
+			}
+		}
+		if cmd.legacy {
+			return nil, nil
+		}
+		if cmd.LastSeq > 0 {
+			return api.replayRoomEvents(ctx, client, cmd)
+		}
+		return api.roomInfo(ctx, cmd.RoomID, cmd.query())
+	case SocketUnsubscribe:
+		sub, ok := client.unsubscribe(cmd.RoomID)
+		if ok && sub.user != "" {
+			return nil, api.Storage.LeaveRoom(ctx, cmd.RoomID, sub.user, client.id)
+		}
+		return nil, nil
+	case SocketSnapshot:
+		return api.roomInfo(ctx, cmd.RoomID, cmd.query())
+	case SocketVote:
+		if cmd.User == "" {
+			return nil, badRequest("user must be given to vote")
+		}
+		token, err := api.claimVoter(ctx, cmd.RoomID, cmd.User, cmd.Token)
+		if err != nil {
+			return nil, toError(err, "failed to check voter")
+		}
+		err = api.Storage.SetUserVotes(ctx, cmd.RoomID, cmd.User, cmd.Votes, cmd.Vetoes)
+		if err != nil {
+			return nil, toError(err, "failed to write votes")
+		}
+		return voteRes{token}, nil
+	case SocketAddGames:
+		return api.addSocketGames(ctx, cmd)
+	}
+	return nil, badRequest("unknown command type " + string(cmd.Type))
+}
+
+// replayRoomEvents resends the updates a resubscribing client missed, falling back to a snapshot of the
+// room if they're no longer all logged. As the client was subscribed first, updates may arrive twice, so
+// clients skip any with a sequence number they've already seen.
+func (api *API) replayRoomEvents(ctx context.Context, client *socketClient, cmd SocketCommand) (interface{}, error) {
+	msgs, ok, err := api.Storage.GetRoomEventsSince(ctx, cmd.RoomID, cmd.LastSeq)
+	if err != nil {
+		return nil, toError(err, "failed to get missed updates for room")
+	}
+	if !ok {
+		return api.roomInfo(ctx, cmd.RoomID, cmd.query())
+	}
+	for _, msg := range msgs {
+		msg.RoomID = cmd.RoomID
+		if !client.send(msg) {
+			break
+		}
+	}
+	return nil, nil
+}
+
+// addSocketGames adds a command's games to its room, looking up the games given by BGG ID
+func (api *API) addSocketGames(ctx context.Context, cmd SocketCommand) (interface{}, error) {
+	if cmd.User == "" {
+		return nil, badRequest("user must be given to add games")
+	}
+	for _, gameID := range cmd.GameIDs {
+		if bggclient.IsCustomID(gameID) {
+			return nil, badRequest("custom games can't be looked up on BGG")
+		}
+	}
+	games := cmd.Games
+	for _, gameID := range cmd.GameIDs {
+		game, err := bggclient.GetGameInfo(ctx, gameID)
+		if err != nil {
+			return nil, toError(err, "failed to get game info from BGG")
+		}
+		games = append(games, game)
+	}
+	if len(games) == 0 {
+		return nil, badRequest("games or gameIDs must be given")
+	}
+	err := api.Storage.AddGamesToRoom(ctx, cmd.RoomID, cmd.User, games)
+	if err != nil {
+		return nil, toError(err, "failed to add games to room")
+	}
+	return addGamesReply{games}, nil
+}
+
+// query returns the command's query parameters along with its user and token, as GetRoomInfo would receive them
+func (cmd SocketCommand) query() url.Values {
+	query := url.Values{}
+	for name, value := range cmd.Query {
+		query.Set(name, value)
+	}
+	if cmd.User != "" {
+		query.Set("user", cmd.User)
+	}
+	if cmd.Token != "" {
+		query.Set("token", cmd.Token)
+	}
+	return query
+}
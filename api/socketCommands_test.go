@@ -0,0 +1,148 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	. "testing"
+
+	"github.com/tylerdixon/bgchooser/storage"
+)
+
+func TestParseSocketCommand(t *T) {
+	tests := []struct {
+		name    string
+		message string
+		want    SocketCommand
+		status  int
+	}{
+		{
+			name:    "json",
+			message: `{"id":"1","type":"vote","roomID":"abc","user":"alice","votes":["13"],"query":{"sort":"votes"}}`,
+			want: SocketCommand{ID: "1", Type: SocketVote, RoomID: "abc", User: "alice", Votes: []string{"13"},
+				Query: map[string]string{"sort": "votes"}},
+		},
+		{
+			name:    "json with surrounding whitespace",
+			message: " \n{\"type\":\"snapshot\",\"roomID\":\"abc\"}",
+			want:    SocketCommand{Type: SocketSnapshot, RoomID: "abc"},
+		},
+		{
+			name:    "legacy register",
+			message: "register:abc",
+			want:    SocketCommand{Type: SocketSubscribe, RoomID: "abc", legacy: true},
+		},
+		{name: "legacy register without room", message: "register:", status: http.StatusBadRequest},
+		{name: "not json", message: "hello", status: http.StatusBadRequest},
+		{name: "malformed json", message: `{"type":"vote",`, status: http.StatusBadRequest},
+		{name: "wrong field type", message: `{"type":"vote","votes":"13"}`, status: http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		cmd, err := parseSocketCommand([]byte(test.message))
+		if test.status != 0 {
+			apiErr, ok := err.(*Error)
+			if !ok || apiErr.Status != test.status {
+				t.Errorf("%s: got error %v, want status %d", test.name, err, test.status)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+			continue
+		}
+		if cmd.ID != test.want.ID || cmd.Type != test.want.Type || cmd.RoomID != test.want.RoomID ||
+			cmd.User != test.want.User || cmd.legacy != test.want.legacy ||
+			len(cmd.Votes) != len(test.want.Votes) || cmd.Query["sort"] != test.want.Query["sort"] {
+			t.Errorf("%s: got %+v, want %+v", test.name, cmd, test.want)
+		}
+	}
+}
+
+func TestRunSocketCommandRejectsInvalidCommands(t *T) {
+	api := &API{hub: newRoomHub(newFakeSubscriptions().subscribe)}
+	client := newSocketClient(&fakeConn{})
+	tests := []struct {
+		name string
+		cmd  SocketCommand
+	}{
+		{name: "missing room", cmd: SocketCommand{Type: SocketSnapshot}},
+		{name: "unknown type", cmd: SocketCommand{Type: "dance", RoomID: "abc"}},
+		{name: "vote without user", cmd: SocketCommand{Type: SocketVote, RoomID: "abc", Votes: []string{"13"}}},
+		{name: "add games without user", cmd: SocketCommand{Type: SocketAddGames, RoomID: "abc", GameIDs: []string{"13"}}},
+		{name: "add games without games", cmd: SocketCommand{Type: SocketAddGames, RoomID: "abc", User: "alice"}},
+		{name: "add custom games by ID", cmd: SocketCommand{Type: SocketAddGames, RoomID: "abc", User: "alice", GameIDs: []string{"custom-abc"}}},
+	}
+	for _, test := range tests {
+		_, err := api.runSocketCommand(context.Background(), client, test.cmd)
+		apiErr, ok := err.(*Error)
+		if !ok || apiErr.Status != http.StatusBadRequest || apiErr.Code != CodeBadRequest {
+			t.Errorf("%s: got error %v, want a bad request", test.name, err)
+		}
+	}
+}
+
+func TestRunSocketCommandSubscriptions(t *T) {
+	subs := newFakeSubscriptions()
+	api := &API{hub: newRoomHub(subs.subscribe)}
+	client := newSocketClient(&fakeConn{})
+
+	// Legacy subscribes are acked with nothing, rather than a snapshot of the room
+	data, err := api.runSocketCommand(context.Background(), client, SocketCommand{Type: SocketSubscribe, RoomID: "abc", legacy: true})
+	if err != nil || data != nil {
+		t.Fatalf("got %v, %v subscribing", data, err)
+	}
+	if subs.count("abc") != 1 {
+		t.Fatalf("got %d subscriptions to the room, want 1", subs.count("abc"))
+	}
+
+	subs.publish("abc", storage.RoomSubscriptionMessage{Type: storage.UpdateTypeResetVotes})
+	msg, ok := (<-client.queue).(storage.RoomSubscriptionMessage)
+	if !ok || msg.Type != storage.UpdateTypeResetVotes || msg.RoomID != "abc" {
+		t.Errorf("got %+v forwarded, want the room's update", msg)
+	}
+
+	_, err = api.runSocketCommand(context.Background(), client, SocketCommand{Type: SocketUnsubscribe, RoomID: "abc"})
+	if err != nil {
+		t.Fatalf("got error %v unsubscribing", err)
+	}
+	if subs.count("abc") != 0 {
+		t.Errorf("got %d subscriptions to the room after unsubscribing, want 0", subs.count("abc"))
+	}
+}
+
+func TestHandleSocketMessageReplies(t *T) {
+	api := &API{hub: newRoomHub(newFakeSubscriptions().subscribe)}
+	tests := []struct {
+		name    string
+		message string
+		// reply is the type of reply expected, or empty if the message shouldn't be replied to
+		reply SocketReplyType
+		id    string
+		code  ErrorCode
+	}{
+		{name: "ack", message: `{"id":"1","type":"unsubscribe","roomID":"abc"}`, reply: SocketReplyAck, id: "1"},
+		{name: "failed command", message: `{"id":"2","type":"vote","roomID":"abc"}`, reply: SocketReplyError, id: "2", code: CodeBadRequest},
+		{name: "unparseable command", message: "hello", reply: SocketReplyError, code: CodeBadRequest},
+		{name: "legacy command", message: "register:abc"},
+	}
+	for _, test := range tests {
+		client := newSocketClient(&fakeConn{})
+		api.handleSocketMessage(context.Background(), client, []byte(test.message))
+		if test.reply == "" {
+			if len(client.queue) != 0 {
+				t.Errorf("%s: got %v, want no reply", test.name, <-client.queue)
+			}
+			continue
+		}
+		if len(client.queue) != 1 {
+			t.Errorf("%s: got %d replies, want 1", test.name, len(client.queue))
+			continue
+		}
+		reply := (<-client.queue).(SocketReply)
+		if reply.Type != test.reply || reply.ID != test.id {
+			t.Errorf("%s: got %s reply to %q, want %s reply to %q", test.name, reply.Type, reply.ID, test.reply, test.id)
+		}
+		if test.code != "" && (reply.Error == nil || reply.Error.Code != test.code) {
+			t.Errorf("%s: got error %+v, want code %s", test.name, reply.Error, test.code)
+		}
+	}
+}
@@ -1 +1,329 @@
 package api
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/gorilla/websocket"
+	"github.com/tylerdixon/bgchooser/storage"
+)
+
+const (
+	// closeFrameTimeout is how long sending a close frame to a room's websocket may take during shutdown
+	closeFrameTimeout = time.Second
+	// writeWait is how long a message may take to write to a websocket
+	writeWait = 10 * time.Second
+	// pongWait is how long a websocket may go without answering a ping before it's considered dropped
+	pongWait = time.Minute
+	// pingPeriod is how often websockets are pinged, leaving time for the pong before pongWait runs out
+	pingPeriod = pongWait * 9 / 10
+	// sendQueueLength is how many messages may wait to be written to a websocket before it's considered
+	// too slow to keep up
+	sendQueueLength = 64
+	// presenceTimeout is how long updating a websocket's presence in its rooms may take
+	presenceTimeout = 5 * time.Second
+)
+
+// socketConn is the part of a websocket connection a socketClient uses
+type socketConn interface {
+	WriteJSON(v interface{}) error
+	WriteControl(messageType int, data []byte, deadline time.Time) error
+	SetWriteDeadline(t time.Time) error
+	Close() error
+}
+
+// socketClient is an open websocket and the rooms it's subscribed to. Messages for it are queued and
+// written by its writer goroutine alone, so a slow connection never holds up whoever sent them.
+type socketClient struct {
+	// id tells apart the connections of a user who has a room open more than once
+	id    string
+	conn  socketConn
+	queue chan interface{}
+	// done is closed along with the connection, stopping the writer
+	done      chan struct{}
+	closeOnce sync.Once
+	mu        sync.Mutex
+	rooms     map[string]roomSubscription
+}
+
+// roomSubscription is a websocket's subscription to a room, along with the user it's present in the room
+// as, if it gave one
+type roomSubscription struct {
+	user        string
+	unsubscribe func() error
+}
+
+func newSocketClient(conn socketConn) *socketClient {
+	return &socketClient{
+		id:    randString(10),
+		conn:  conn,
+		queue: make(chan interface{}, sendQueueLength),
+		done:  make(chan struct{}),
+		rooms: make(map[string]roomSubscription),
+	}
+}
+
+// send queues a message to be written to the websocket as JSON, returning false if it won't be. A
+// websocket whose queue is full is closed rather than let it fall further behind; its client can
+// reconnect and replay the updates it missed.
+func (c *socketClient) send(v interface{}) bool {
+	select {
+	case <-c.done:
+		return false
+	default:
+	}
+	select {
+	case c.queue <- v:
+		return true
+	default:
+		log.Warn(log.Fields{"socketID": c.id}, "Closing socket that fell behind on its messages")
+		slowSocketsClosed.Inc()
+		c.close()
+		return false
+	}
+}
+
+// close closes the websocket, which also ends its read loop
+func (c *socketClient) close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.conn.Close()
+	})
+}
+
+// writeLoop writes the queued messages to the websocket until it's closed, pinging it every period so
+// a dropped connection is noticed by its read deadline running out. refresh is called along with each ping.
+func (c *socketClient) writeLoop(period time.Duration, refresh func()) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case msg := <-c.queue:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteJSON(msg); err != nil {
+				log.Warn(log.Fields{"socketID": c.id, "err": err}, "Failed to write to socket")
+				c.close()
+				return
+			}
+		case <-ticker.C:
+			if err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait)); err != nil {
+				c.close()
+				return
+			}
+			go refresh()
+		}
+	}
+}
+
+// subscribe forwards a room's updates to the websocket, returning false if it was already subscribed
+func (c *socketClient) subscribe(hub *roomHub, roomID, user string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.rooms[roomID]; ok {
+		return false
+	}
+	unsubscribe := hub.add(roomID, func(msg storage.RoomSubscriptionMessage) {
+		log.Info(log.Fields{"roomID": roomID, "msgType": msg.Type}, "Socket event sent")
+		msg.RoomID = roomID
+		c.send(msg)
+	})
+	c.rooms[roomID] = roomSubscription{user: user, unsubscribe: unsubscribe}
+	return true
+}
+
+// unsubscribe stops forwarding a room's updates, returning the subscription if there was one
+func (c *socketClient) unsubscribe(roomID string) (roomSubscription, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	sub, ok := c.rooms[roomID]
+	if ok {
+		sub.unsubscribe()
+		delete(c.rooms, roomID)
+	}
+	return sub, ok
+}
+
+// unsubscribeAll stops forwarding the updates of every room, returning the subscriptions by room ID
+func (c *socketClient) unsubscribeAll() map[string]roomSubscription {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for roomID, sub := range c.rooms {
+		if err := sub.unsubscribe(); err != nil {
+			log.Warn(log.Fields{"roomID": roomID, "err": err}, "Failed to unsubscribe from room")
+		}
+	}
+	rooms := c.rooms
+	c.rooms = make(map[string]roomSubscription)
+	return rooms
+}
+
+// presences returns the users the websocket is present as, by room ID
+func (c *socketClient) presences() map[string]string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	users := make(map[string]string)
+	for roomID, sub := range c.rooms {
+		if sub.user != "" {
+			users[roomID] = sub.user
+		}
+	}
+	return users
+}
+
+// closeGoingAway sends the client a close frame saying the server is shutting down
+func (c *socketClient) closeGoingAway() error {
+	msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+	return c.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(closeFrameTimeout))
+}
+
+// socketRegistry tracks the open room websockets, so they can be closed when the server shuts down
+type socketRegistry struct {
+	mu      sync.Mutex
+	clients map[*socketClient]bool
+	closed  bool
+}
+
+func newSocketRegistry() *socketRegistry {
+	return &socketRegistry{clients: make(map[*socketClient]bool)}
+}
+
+// add registers a websocket, returning false if the server is already shutting down
+func (s *socketRegistry) add(c *socketClient) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	s.clients[c] = true
+	activeSockets.Inc()
+	return true
+}
+
+func (s *socketRegistry) remove(c *socketClient) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.clients[c] {
+		delete(s.clients, c)
+		activeSockets.Dec()
+	}
+}
+
+// closeAll releases every websocket from its rooms and sends it a close frame, leaving the connection
+// to be closed once the client acknowledges. Websockets added afterwards are refused. The websockets
+// are released in parallel, and outside the lock, so a slow release doesn't hold up the others.
+func (s *socketRegistry) closeAll(ctx context.Context, release func(context.Context, *socketClient)) {
+	s.mu.Lock()
+	s.closed = true
+	clients := s.clients
+	s.clients = make(map[*socketClient]bool)
+	activeSockets.Sub(float64(len(clients)))
+	s.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for c := range clients {
+		wg.Add(1)
+		go func(c *socketClient) {
+			defer wg.Done()
+			release(ctx, c)
+			if err := c.closeGoingAway(); err != nil {
+				log.Warn(log.Fields{"err": err}, "Failed to send close frame")
+				c.close()
+			}
+		}(c)
+	}
+	wg.Wait()
+}
+
+// releaseSocket unsubscribes a websocket from its rooms and removes it from their presence
+func (api *API) releaseSocket(ctx context.Context, client *socketClient) {
+	for roomID, sub := range client.unsubscribeAll() {
+		if sub.user == "" {
+			continue
+		}
+		if err := api.Storage.LeaveRoom(ctx, roomID, sub.user, client.id); err != nil {
+			log.Warn(log.Fields{"roomID": roomID, "user": sub.user, "err": err}, "Failed to leave room")
+		}
+	}
+}
+
+// refreshPresence keeps a websocket present in the rooms it's subscribed to, as long as it's still answering pings
+func (api *API) refreshPresence(client *socketClient) {
+	ctx, cancel := context.WithTimeout(context.Background(), presenceTimeout)
+	defer cancel()
+	for roomID, user := range client.presences() {
+		if err := api.Storage.RefreshPresence(ctx, roomID, user, client.id); err != nil {
+			log.Warn(log.Fields{"roomID": roomID, "user": user, "err": err}, "Failed to refresh presence in room")
+		}
+	}
+}
+
+// socketInit upgrades a request to a websocket that clients send SocketCommands over, replying to each
+// and forwarding the updates of the rooms they subscribe to
+func (api *API) socketInit(w http.ResponseWriter, r *http.Request) {
+	c, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Print("upgrade:", err)
+		return
+	}
+	client := newSocketClient(c)
+	defer client.close()
+	if !api.sockets.add(client) {
+		client.closeGoingAway()
+		return
+	}
+	defer api.sockets.remove(client)
+	defer func() {
+		// The request's context is done once the connection ends, so it can't be used to leave the rooms
+		ctx, cancel := context.WithTimeout(context.Background(), presenceTimeout)
+		defer cancel()
+		api.releaseSocket(ctx, client)
+	}()
+
+	c.SetReadDeadline(time.Now().Add(pongWait))
+	c.SetPongHandler(func(string) error {
+		return c.SetReadDeadline(time.Now().Add(pongWait))
+	})
+	go client.writeLoop(pingPeriod, func() { api.refreshPresence(client) })
+
+	for {
+		_, message, err := c.ReadMessage()
+		if err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				log.Println("socket err: " + err.Error())
+			}
+			return
+		}
+		api.handleSocketMessage(r.Context(), client, message)
+		// Pongs can't arrive while a command runs, so a slow one mustn't count against the connection
+		c.SetReadDeadline(time.Now().Add(pongWait))
+	}
+}
+
+// handleSocketMessage runs a command received over a websocket and replies to it
+func (api *API) handleSocketMessage(ctx context.Context, client *socketClient, message []byte) {
+	cmd, err := parseSocketCommand(message)
+	if err != nil {
+		client.send(SocketReply{Type: SocketReplyError, Error: toError(err, "failed to parse command")})
+		return
+	}
+	data, err := api.runSocketCommand(ctx, client, cmd)
+	reply := SocketReply{Type: SocketReplyAck, ID: cmd.ID, Data: data}
+	if err != nil {
+		apiErr := toError(err, "failed to run "+string(cmd.Type)+" command")
+		if apiErr.Status >= http.StatusInternalServerError {
+			log.Error(log.Fields{"roomID": cmd.RoomID, "command": cmd.Type}, apiErr.cause)
+		}
+		reply = SocketReply{Type: SocketReplyError, ID: cmd.ID, Error: apiErr}
+	}
+	// Clients of the original protocol don't expect replies, even when their command fails
+	if cmd.legacy {
+		return
+	}
+	client.send(reply)
+}
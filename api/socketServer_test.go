@@ -0,0 +1,162 @@
+package api
+
+import (
+	"context"
+	"sync"
+	. "testing"
+	"time"
+)
+
+// fakeConn records what's written to it, blocking writes until unblocked when it's made slow
+type fakeConn struct {
+	mu      sync.Mutex
+	written []interface{}
+	pings   int
+	closed  bool
+	unblock chan struct{}
+}
+
+func (c *fakeConn) WriteJSON(v interface{}) error {
+	if c.unblock != nil {
+		<-c.unblock
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.written = append(c.written, v)
+	return nil
+}
+
+func (c *fakeConn) WriteControl(messageType int, data []byte, deadline time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pings++
+	return nil
+}
+
+func (c *fakeConn) SetWriteDeadline(t time.Time) error { return nil }
+
+func (c *fakeConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	return nil
+}
+
+func (c *fakeConn) writes() []interface{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]interface{}(nil), c.written...)
+}
+
+// waitFor polls until cond holds, failing the test if it doesn't within a second
+func waitFor(t *T, cond func() bool, what string) {
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+type testMessage struct {
+	sender, n int
+}
+
+func TestSocketClientConcurrentSends(t *T) {
+	conn := &fakeConn{}
+	client := newSocketClient(conn)
+	go client.writeLoop(time.Millisecond, func() {})
+	defer client.close()
+
+	// Each sender waits for room in the queue, as a sender that outpaces the writer would get closed
+	const senders, perSender = 4, 50
+	var wg sync.WaitGroup
+	for sender := 0; sender < senders; sender++ {
+		wg.Add(1)
+		go func(sender int) {
+			defer wg.Done()
+			for n := 0; n < perSender; n++ {
+				for len(client.queue) > sendQueueLength/2 {
+					time.Sleep(time.Millisecond)
+				}
+				if !client.send(testMessage{sender, n}) {
+					t.Errorf("expected message %d from sender %d to be queued", n, sender)
+					return
+				}
+			}
+		}(sender)
+	}
+	wg.Wait()
+	waitFor(t, func() bool { return len(conn.writes()) == senders*perSender }, "every message to be written")
+
+	next := make([]int, senders)
+	for _, msg := range conn.writes() {
+		m := msg.(testMessage)
+		if m.n != next[m.sender] {
+			t.Fatalf("expected message %d from sender %d, got %d", next[m.sender], m.sender, m.n)
+		}
+		next[m.sender]++
+	}
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	if conn.pings == 0 {
+		t.Errorf("expected the socket to be pinged")
+	}
+}
+
+func TestSocketClientClosesSlowConsumer(t *T) {
+	conn := &fakeConn{unblock: make(chan struct{})}
+	client := newSocketClient(conn)
+	go client.writeLoop(time.Hour, func() {})
+
+	// The first message is held by the blocked writer, then the queue fills up behind it
+	if !client.send(0) {
+		t.Fatalf("expected the first message to be queued")
+	}
+	waitFor(t, func() bool { return len(client.queue) == 0 }, "the writer to take the first message")
+	for i := 1; i <= sendQueueLength; i++ {
+		if !client.send(i) {
+			t.Fatalf("expected message %d to be queued", i)
+		}
+	}
+	if client.send("overflow") {
+		t.Fatalf("expected a message past the queue's length to be refused")
+	}
+	close(conn.unblock)
+
+	select {
+	case <-client.done:
+	case <-time.After(time.Second):
+		t.Fatalf("expected the slow socket to be closed")
+	}
+	conn.mu.Lock()
+	closed := conn.closed
+	conn.mu.Unlock()
+	if !closed {
+		t.Errorf("expected the slow socket's connection to be closed")
+	}
+	if client.send("after close") {
+		t.Errorf("expected a closed socket to refuse messages")
+	}
+}
+
+func TestSocketRegistryCloseAll(t *T) {
+	registry := newSocketRegistry()
+	clients := []*socketClient{newSocketClient(&fakeConn{}), newSocketClient(&fakeConn{})}
+	for _, c := range clients {
+		if !registry.add(c) {
+			t.Fatalf("expected socket to be added before shutdown")
+		}
+	}
+	registry.remove(clients[1])
+
+	var released []*socketClient
+	registry.closeAll(context.Background(), func(ctx context.Context, c *socketClient) { released = append(released, c) })
+	if len(released) != 1 || released[0] != clients[0] {
+		t.Errorf("expected only the open socket to be released, got %v", released)
+	}
+	if registry.add(newSocketClient(&fakeConn{})) {
+		t.Errorf("expected sockets to be refused after shutdown")
+	}
+}
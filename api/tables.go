@@ -0,0 +1,104 @@
+package api
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/tylerdixon/bgchooser/chooser"
+)
+
+const (
+	// defaultTables is how many tables members are split into when no number is given
+	defaultTables = 2
+	// defaultTableSplits is how many splits are returned when no limit is given
+	defaultTableSplits = 3
+)
+
+type splitTablesBody struct {
+	HostKey string `json:"hostKey"`
+}
+
+// splitTables proposes ways of splitting the room's voters, or the members given by the comma
+// separated `members` query parameter, into the number of tables given by the `tables` query
+// parameter. The best split is broadcast to the room, so only the host can split the room into tables.
+func (a *API) splitTables(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	roomID := vars["roomID"]
+	tables, err := queryInt(r.URL.Query(), "tables")
+	if err != nil {
+		writeBadRequest(w, r, "tables must be a positive number")
+		return
+	}
+	if tables == 0 {
+		tables = defaultTables
+	}
+	if tables > chooser.MaxTables {
+		writeBadRequest(w, r, "tables must be at most "+strconv.Itoa(chooser.MaxTables))
+		return
+	}
+	limit, err := queryInt(r.URL.Query(), "limit")
+	if err != nil {
+		writeBadRequest(w, r, "limit must be a positive number")
+		return
+	}
+	if limit == 0 {
+		limit = defaultTableSplits
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, r, err, "failed to read body from request")
+		return
+	}
+	var req splitTablesBody
+	err = json.Unmarshal(body, &req)
+	if err != nil {
+		writeBadRequest(w, r, "failed to unmarshal body: "+err.Error())
+		return
+	}
+	if _, ok := a.checkHost(w, r, roomID, req.HostKey); !ok {
+		return
+	}
+
+	votes, ok := a.revealedVotes(w, r, roomID)
+	if !ok {
+		return
+	}
+	var members []string
+	if param := r.URL.Query().Get("members"); param != "" {
+		members = strings.Split(param, ",")
+	} else {
+		for member := range votes.Votes {
+			members = append(members, member)
+		}
+		sort.Strings(members)
+	}
+	games, err := a.Storage.GetGamesForRoom(r.Context(), roomID)
+	if err != nil {
+		writeError(w, r, err, "failed to get games for room")
+		return
+	}
+
+	splits := chooser.SplitTables(games, votes, members, tables, limit)
+	if len(splits) == 0 {
+		writeConflict(w, r, "no games can seat every member across that many tables")
+		return
+	}
+	err = a.Storage.PublishTables(r.Context(), roomID, splits[0])
+	if err != nil {
+		writeError(w, r, err, "failed to broadcast tables to room")
+		return
+	}
+
+	resBody, err := json.Marshal(splits)
+	if err != nil {
+		writeError(w, r, err, "failed to marshal response for tables")
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(resBody)
+}
@@ -1,11 +1,13 @@
 package bggclient
 
 import (
+	"context"
 	"encoding/xml"
 	"io/ioutil"
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -15,7 +17,34 @@ import (
 )
 
 type collectionRes struct {
-	Games []Game `xml:"item"`
+	Items []collectionItem `xml:"item"`
+}
+
+type collectionItem struct {
+	ID        string          `xml:"objectid,attr"`
+	Name      string          `xml:"name"`
+	Thumbnail string          `xml:"thumbnail"`
+	Stats     collectionStats `xml:"stats"`
+}
+
+type collectionStats struct {
+	GameInfo
+	Rating collectionRating `xml:"rating"`
+}
+
+// collectionRating holds the collection owner's own rating, which is "N/A" if they haven't rated the game
+type collectionRating struct {
+	Value   string    `xml:"value,attr"`
+	Average valueAttr `xml:"average"`
+}
+
+// CustomIDPrefix marks the IDs of games added by hand rather than from BGG. BGG IDs are always numeric,
+// so the two can't collide.
+const CustomIDPrefix = "custom-"
+
+// IsCustomID returns whether a game ID belongs to a game added by hand, which BGG knows nothing about
+func IsCustomID(id string) bool {
+	return strings.HasPrefix(id, CustomIDPrefix)
 }
 
 type Game struct {
@@ -23,13 +52,16 @@ type Game struct {
 	Name      string   `xml:"name" json:"name"`
 	Thumbnail string   `xml:"thumbnail" json:"thumbnail"`
 	Info      GameInfo `xml:"stats" json:"info"`
+	// Rating is the personal rating of the user whose collection the game came from, or 0 if they haven't rated it
+	Rating float64 `xml:"-" json:"rating,omitempty"`
 }
 
 type GameInfo struct {
-	MinPlayers  int `xml:"minplayers,attr" json:"minPlayers"`
-	MaxPlayers  int `xml:"maxplayers,attr" json:"maxPlayers"`
-	MinPlaytime int `xml:"minplaytime,attr" json:"minPlaytime"`
-	MaxPlaytime int `xml:"maxplaytime,attr" json:"maxPlaytime"`
+	MinPlayers    int     `xml:"minplayers,attr" json:"minPlayers"`
+	MaxPlayers    int     `xml:"maxplayers,attr" json:"maxPlayers"`
+	MinPlaytime   int     `xml:"minplaytime,attr" json:"minPlaytime"`
+	MaxPlaytime   int     `xml:"maxplaytime,attr" json:"maxPlaytime"`
+	AverageRating float64 `xml:"-" json:"averageRating,omitempty"`
 }
 
 type getGameRes struct {
@@ -44,6 +76,9 @@ type singleGame struct {
 	MaxPlayers  valueAttr   `xml:"maxplayers" json:"maxPlayers"`
 	MinPlaytime valueAttr   `xml:"minplaytime" json:"minPlaytime"`
 	MaxPlaytime valueAttr   `xml:"maxplaytime" json:"maxPlaytime"`
+	Polls       []poll      `xml:"poll" json:"-"`
+	Ratings     ratingStats `xml:"statistics>ratings" json:"-"`
+	Links       []valueAttr `xml:"link" json:"-"`
 }
 
 type valueAttr struct {
@@ -51,59 +86,211 @@ type valueAttr struct {
 	Type  string `xml:"type,attr"`
 }
 
-func GetGameInfo(gameID string) (Game, error) {
-	reqString := "https://boardgamegeek.com/xmlapi2/thing?type=boardgame&id=" + url.QueryEscape(gameID)
-	res, err := http.Get(reqString)
+// int returns the attribute's value as a number, or 0 if it isn't one
+func (a valueAttr) int() int {
+	i, err := strconv.Atoi(a.Value)
+	if err != nil {
+		return 0
+	}
+	return i
+}
+
+type poll struct {
+	Name    string        `xml:"name,attr"`
+	Results []pollResults `xml:"results"`
+}
+
+type pollResults struct {
+	NumPlayers string       `xml:"numplayers,attr"`
+	Results    []pollResult `xml:"result"`
+}
+
+type pollResult struct {
+	Value    string `xml:"value,attr"`
+	NumVotes int    `xml:"numvotes,attr"`
+}
+
+type ratingStats struct {
+	Average       valueAttr `xml:"average"`
+	AverageWeight valueAttr `xml:"averageweight"`
+}
+
+// GameDetails represents the community statistics for a game, which are only available when fetching games individually
+type GameDetails struct {
+	ID            string   `json:"id"`
+	BestPlayers   []int    `json:"bestPlayers"`
+	GoodPlayers   []int    `json:"goodPlayers"`
+	Weight        float64  `json:"weight"`
+	AverageRating float64  `json:"averageRating"`
+	Categories    []string `json:"categories"`
+	Mechanics     []string `json:"mechanics"`
+}
+
+// maxThingIDs is how many games BGG's thing API returns in a single request
+const maxThingIDs = 20
+
+// do makes a request to BGG once the rate limit allows, abandoning it if the context is cancelled
+func do(ctx context.Context, req *http.Request) (*http.Response, error) {
+	if err := rateLimit.wait(ctx); err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	res, err := http.DefaultClient.Do(req.WithContext(ctx))
+	observeRequest(req, res, err, time.Since(start))
+	return res, err
+}
+
+// Ping checks that BGG can be reached, without regard to what it responds with
+func Ping(ctx context.Context) error {
+	res, err := get(ctx, baseURL+"/thing?id=1")
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode >= 500 {
+		return &StatusError{StatusCode: res.StatusCode}
+	}
+	return nil
+}
+
+// get requests a BGG API endpoint
+func get(ctx context.Context, reqString string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", reqString, nil)
+	if err != nil {
+		return nil, err
+	}
+	return do(ctx, req)
+}
+
+// GetGameInfo fetches a single game from BGG. Player counts and playtimes that BGG leaves out or
+// doesn't give as numbers are left as 0.
+func GetGameInfo(ctx context.Context, gameID string) (Game, error) {
+	reqString := baseURL + "/thing?type=boardgame&id=" + url.QueryEscape(gameID)
+	res, err := get(ctx, reqString)
 	if err != nil {
 		return Game{}, err
 	}
+	defer res.Body.Close()
 	body, err := ioutil.ReadAll(res.Body)
 	if err != nil {
 		return Game{}, err
 	}
+	if res.StatusCode != 200 {
+		return Game{}, &StatusError{res.StatusCode, string(body)}
+	}
 
 	var gameRes getGameRes
 	err = xml.Unmarshal(body, &gameRes)
+	if err != nil {
+		return Game{}, errors.Wrap(err, "failed to parse game of ID "+gameID)
+	}
 	if len(gameRes.Items) == 0 {
-		return Game{}, errors.New("Failed to find game of ID: " + gameID)
+		return Game{}, errors.Wrap(ErrGameNotFound, "failed to find game of ID "+gameID)
 	}
+	item := gameRes.Items[0]
 	game := Game{
-		ID:        gameRes.Items[0].ID,
-		Thumbnail: gameRes.Items[0].Thumbnail,
+		ID:        item.ID,
+		Thumbnail: item.Thumbnail,
 		Info:      GameInfo{},
 	}
+	game.Info.MaxPlayers = item.MaxPlayers.int()
+	game.Info.MinPlayers = item.MinPlayers.int()
+	game.Info.MaxPlaytime = item.MaxPlaytime.int()
+	game.Info.MinPlaytime = item.MinPlaytime.int()
 
-	i, err := strconv.Atoi(gameRes.Items[0].MaxPlayers.Value)
-	if err == nil {
-		game.Info.MaxPlayers = i
+	for _, name := range item.Name {
+		if name.Type == "primary" {
+			game.Name = name.Value
+		}
 	}
 
-	i, err = strconv.Atoi(gameRes.Items[0].MinPlayers.Value)
-	if err == nil {
-		game.Info.MinPlayers = i
-	}
+	return game, nil
+}
 
-	i, err = strconv.Atoi(gameRes.Items[0].MaxPlaytime.Value)
-	if err == nil {
-		game.Info.MaxPlaytime = i
-	}
+// GetGameDetails retrieves the community statistics for a set of games, keyed by game ID
+func GetGameDetails(ctx context.Context, gameIDs []string) (map[string]GameDetails, error) {
+	details := make(map[string]GameDetails)
+	for start := 0; start < len(gameIDs); start += maxThingIDs {
+		end := start + maxThingIDs
+		if end > len(gameIDs) {
+			end = len(gameIDs)
+		}
+		var ids []string
+		for _, gameID := range gameIDs[start:end] {
+			ids = append(ids, url.QueryEscape(gameID))
+		}
+		reqString := baseURL + "/thing?type=boardgame&stats=1&id=" + strings.Join(ids, ",")
+		res, err := get(ctx, reqString)
+		if err != nil {
+			return details, err
+		}
+		body, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			return details, err
+		}
+		if res.StatusCode != 200 {
+			return details, &StatusError{res.StatusCode, string(body)}
+		}
 
-	i, err = strconv.Atoi(gameRes.Items[0].MinPlaytime.Value)
-	if err == nil {
-		game.Info.MinPlaytime = i
+		var gameRes getGameRes
+		err = xml.Unmarshal(body, &gameRes)
+		if err != nil {
+			return details, err
+		}
+		for _, item := range gameRes.Items {
+			details[item.ID] = parseGameDetails(item)
+		}
 	}
+	return details, nil
+}
 
-	for _, name := range gameRes.Items[0].Name {
-		if name.Type == "primary" {
-			game.Name = name.Value
+// parseGameDetails reads the player counts the community votes as best or recommended, along with
+// the game's average weight, rating, categories and mechanics. Open ended player counts such as "4+" are ignored.
+func parseGameDetails(item singleGame) GameDetails {
+	details := GameDetails{
+		ID: item.ID,
+	}
+	details.Weight, _ = strconv.ParseFloat(item.Ratings.AverageWeight.Value, 64)
+	details.AverageRating, _ = strconv.ParseFloat(item.Ratings.Average.Value, 64)
+	for _, link := range item.Links {
+		switch link.Type {
+		case "boardgamecategory":
+			details.Categories = append(details.Categories, link.Value)
+		case "boardgamemechanic":
+			details.Mechanics = append(details.Mechanics, link.Value)
 		}
 	}
-
-	return game, err
-
+	for _, p := range item.Polls {
+		if p.Name != "suggested_numplayers" {
+			continue
+		}
+		for _, results := range p.Results {
+			numPlayers, err := strconv.Atoi(results.NumPlayers)
+			if err != nil {
+				continue
+			}
+			votes := make(map[string]int)
+			for _, result := range results.Results {
+				votes[result.Value] = result.NumVotes
+			}
+			best, recommended, notRecommended := votes["Best"], votes["Recommended"], votes["Not Recommended"]
+			if best == 0 && recommended == 0 {
+				continue
+			}
+			if best >= recommended && best >= notRecommended {
+				details.BestPlayers = append(details.BestPlayers, numPlayers)
+			} else if best+recommended >= notRecommended {
+				details.GoodPlayers = append(details.GoodPlayers, numPlayers)
+			}
+		}
+	}
+	return details
 }
 
-func GetUserCollection(userID string, r *http.Request) ([]Game, error) {
+// GetUserCollection retrieves the board games a user owns, retrying while BGG prepares the collection.
+// forwardedFor is the `X-Forwarded-For` header of the request the collection is fetched for.
+func GetUserCollection(ctx context.Context, userID, forwardedFor string) ([]Game, error) {
 	var res *http.Response
 	var err error
 	var wg sync.WaitGroup
@@ -112,44 +299,51 @@ func GetUserCollection(userID string, r *http.Request) ([]Game, error) {
 
 	go func() {
 		defer wg.Done()
-		reqString := "https://boardgamegeek.com/xmlapi2/collection?username=" + url.QueryEscape(userID) + "&own=1&excludesubtype=boardgameexpansion&stats=1&wishlist=0"
+		reqString := baseURL + "/collection?username=" + url.QueryEscape(userID) + "&own=1&excludesubtype=boardgameexpansion&stats=1&wishlist=0"
 
 		// Forward the `X-Forwarded-For` header, since (I believe) this is what the
 		// BGG XML API uses to rate limit users. Without this, all requests coming from this
 		// server are subject to the same rate limiting. IMO, this should instead be relative
 		// to the user's making the request. I would instead do this from the browser
 		// if the API didn't have weird CORs shenanigans on non-200 responses.
-		client := &http.Client{}
 		var req *http.Request
 		req, err = http.NewRequest("GET", reqString, nil)
 		if err != nil {
 			log.Error(log.Fields{"userID": userID}, "Failed to create request for user")
 			return
 		}
-		req.Header.Add("X-Forwarded-For", r.Header.Get("X-Forwarded-For"))
-		res, err = client.Do(req)
-		for res.StatusCode == 202 && err == nil && numRetries < 10 {
+		req.Header.Add("X-Forwarded-For", forwardedFor)
+		res, err = do(ctx, req)
+		for err == nil && res.StatusCode == 202 && numRetries < 10 {
+			// Each response is replaced by the retry's, so its body is closed to free up the connection
+			res.Body.Close()
 			numRetries++
-			time.Sleep(time.Second)
-			res, err = http.Get(reqString)
-			if res.StatusCode == 202 {
-				err = nil
+			retriesTotal.Inc()
+			select {
+			case <-ctx.Done():
+				err = ctx.Err()
+				return
+			case <-time.After(time.Second):
 			}
+			res, err = do(ctx, req)
 		}
-		if numRetries >= 10 {
-			err = errors.New("exceeded number of retries")
+		if err == nil && res.StatusCode == 202 {
+			res.Body.Close()
+			err = ErrProcessing
 		}
 	}()
 	wg.Wait()
 
 	if err != nil {
 		return []Game{}, err
-	} else if res.StatusCode != 200 {
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
 		body, err := ioutil.ReadAll(res.Body)
 		if err != nil {
 			return []Game{}, err
 		}
-		return []Game{}, errors.New("non-200 received from bgg: " + string(body))
+		return []Game{}, &StatusError{res.StatusCode, string(body)}
 	}
 
 	body, err := ioutil.ReadAll(res.Body)
@@ -157,8 +351,34 @@ func GetUserCollection(userID string, r *http.Request) ([]Game, error) {
 		return []Game{}, err
 	}
 
+	return parseCollection(body)
+}
+
+func parseCollection(body []byte) ([]Game, error) {
+	if err := parseErrors(body); err != nil {
+		return []Game{}, err
+	}
 	var collRes collectionRes
-	err = xml.Unmarshal(body, &collRes)
+	err := xml.Unmarshal(body, &collRes)
+	if err != nil {
+		return []Game{}, err
+	}
 
-	return collRes.Games, err
+	games := make([]Game, len(collRes.Items))
+	for i, item := range collRes.Items {
+		games[i] = Game{
+			ID:        item.ID,
+			Name:      item.Name,
+			Thumbnail: item.Thumbnail,
+			Info:      item.Stats.GameInfo,
+		}
+		// Unrated games have a rating of "N/A", which is left as 0
+		if rating, err := strconv.ParseFloat(item.Stats.Rating.Value, 64); err == nil {
+			games[i].Rating = rating
+		}
+		if average, err := strconv.ParseFloat(item.Stats.Rating.Average.Value, 64); err == nil {
+			games[i].Info.AverageRating = average
+		}
+	}
+	return games, nil
 }
@@ -1,9 +1,181 @@
 package bggclient
 
 import (
+	"context"
+	"encoding/xml"
+	"net/http"
 	. "testing"
+
+	"github.com/pkg/errors"
 )
 
 func TestGetCollection(t *T) {
 	// res, err := GetUserCollection("roosevelvet")
 }
+
+func TestGetGameInfo(t *T) {
+	serveBGG(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("id") {
+		case "230802":
+			w.Write([]byte(`<items termsofuse="https://boardgamegeek.com/xmlapi/termsofuse">
+	<item type="boardgame" id="230802">
+		<thumbnail>https://cf.geekdo-images.com/azul.jpg</thumbnail>
+		<name type="primary" sortindex="1" value="Azul" />
+		<name type="alternate" sortindex="1" value="Azul: Mosaico" />
+		<minplayers value="2" />
+		<maxplayers value="4" />
+		<minplaytime value="30" />
+		<maxplaytime value="99999999999999999999" />
+	</item>
+</items>`))
+		case "0":
+			w.Write([]byte(`<items termsofuse="https://boardgamegeek.com/xmlapi/termsofuse"></items>`))
+		case "1":
+			w.Write([]byte(`<items`))
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	})
+
+	game, err := GetGameInfo(context.Background(), "230802")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if game.ID != "230802" || game.Name != "Azul" || game.Thumbnail != "https://cf.geekdo-images.com/azul.jpg" {
+		t.Errorf("expected Azul, got %+v", game)
+	}
+	if game.Info.MinPlayers != 2 || game.Info.MaxPlayers != 4 || game.Info.MinPlaytime != 30 || game.Info.MaxPlaytime != 0 {
+		t.Errorf("expected 2-4 players and 30 minutes, with the bad max playtime left out, got %+v", game.Info)
+	}
+
+	if _, err := GetGameInfo(context.Background(), "0"); errors.Cause(err) != ErrGameNotFound {
+		t.Errorf("expected an unknown game to not be found, got %v", err)
+	}
+	if _, err := GetGameInfo(context.Background(), "1"); err == nil || errors.Cause(err) == ErrGameNotFound {
+		t.Errorf("expected a malformed game to fail to parse, got %v", err)
+	}
+	if _, err := GetGameInfo(context.Background(), "2"); err == nil {
+		t.Error("expected a failed request to fail")
+	} else if statusErr, ok := err.(*StatusError); !ok || statusErr.StatusCode != http.StatusInternalServerError {
+		t.Errorf("expected a 500 status error, got %v", err)
+	}
+}
+
+func TestParseCollection(t *T) {
+	games, err := parseCollection([]byte(`<?xml version="1.0" encoding="utf-8" standalone="yes"?>
+<items totalitems="2" termsofuse="https://boardgamegeek.com/xmlapi/termsofuse" pubdate="Sat, 07 Mar 2020 22:04:06 +0000">
+	<item objecttype="thing" objectid="230802" subtype="boardgame" collid="1">
+		<name sortindex="1">Azul</name>
+		<thumbnail>https://cf.geekdo-images.com/thumb/img/azul.jpg</thumbnail>
+		<stats minplayers="2" maxplayers="4" minplaytime="30" maxplaytime="45" playingtime="45" numowned="1">
+			<rating value="8.5">
+				<usersrated value="1" />
+				<average value="7.81" />
+			</rating>
+		</stats>
+	</item>
+	<item objecttype="thing" objectid="13" subtype="boardgame" collid="2">
+		<name sortindex="1">Catan</name>
+		<stats minplayers="3" maxplayers="4" minplaytime="60" maxplaytime="120" playingtime="120" numowned="1">
+			<rating value="N/A">
+				<average value="7.16" />
+			</rating>
+		</stats>
+	</item>
+</items>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(games) != 2 {
+		t.Fatalf("expected 2 games, got %+v", games)
+	}
+
+	azul := games[0]
+	if azul.ID != "230802" || azul.Name != "Azul" || azul.Rating != 8.5 {
+		t.Errorf("expected Azul rated 8.5, got %+v", azul)
+	}
+	if azul.Info.MinPlayers != 2 || azul.Info.MaxPlaytime != 45 || azul.Info.AverageRating != 7.81 {
+		t.Errorf("expected Azul's stats to be parsed, got %+v", azul.Info)
+	}
+	if catan := games[1]; catan.Rating != 0 || catan.Info.AverageRating != 7.16 {
+		t.Errorf("expected Catan to be unrated, got %+v", catan)
+	}
+}
+
+func TestParseCollectionUnknownUser(t *T) {
+	_, err := parseCollection([]byte(`<?xml version="1.0" encoding="utf-8" standalone="yes"?>
+<errors>
+	<error>
+		<message>Invalid username specified</message>
+	</error>
+</errors>`))
+	if err != ErrUserNotFound {
+		t.Errorf("expected an unknown user to be reported, got %v", err)
+	}
+}
+
+func TestParseGameDetails(t *T) {
+	var gameRes getGameRes
+	err := xml.Unmarshal([]byte(`<?xml version="1.0" encoding="utf-8"?>
+<items termsofuse="https://boardgamegeek.com/xmlapi/termsofuse">
+	<item type="boardgame" id="13">
+		<name type="primary" sortindex="1" value="Catan" />
+		<minplayers value="3" />
+		<maxplayers value="4" />
+		<link type="boardgamecategory" id="1021" value="Economic" />
+		<link type="boardgamecategory" id="1026" value="Negotiation" />
+		<link type="boardgamemechanic" id="2072" value="Dice Rolling" />
+		<link type="boardgamedesigner" id="11" value="Klaus Teuber" />
+		<poll name="suggested_numplayers" title="User Suggested Number of Players" totalvotes="100">
+			<results numplayers="2">
+				<result value="Best" numvotes="1" />
+				<result value="Recommended" numvotes="5" />
+				<result value="Not Recommended" numvotes="80" />
+			</results>
+			<results numplayers="3">
+				<result value="Best" numvotes="20" />
+				<result value="Recommended" numvotes="50" />
+				<result value="Not Recommended" numvotes="10" />
+			</results>
+			<results numplayers="4">
+				<result value="Best" numvotes="70" />
+				<result value="Recommended" numvotes="20" />
+				<result value="Not Recommended" numvotes="2" />
+			</results>
+			<results numplayers="4+">
+				<result value="Best" numvotes="5" />
+				<result value="Recommended" numvotes="1" />
+				<result value="Not Recommended" numvotes="0" />
+			</results>
+		</poll>
+		<poll name="language_dependence" title="Language Dependence" totalvotes="1" />
+		<statistics page="1">
+			<ratings>
+				<usersrated value="100000" />
+				<average value="7.16" />
+				<averageweight value="2.32" />
+			</ratings>
+		</statistics>
+	</item>
+</items>`), &gameRes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	details := parseGameDetails(gameRes.Items[0])
+	if details.ID != "13" || details.Weight != 2.32 || details.AverageRating != 7.16 {
+		t.Errorf("expected Catan's stats to be parsed, got %+v", details)
+	}
+	if len(details.BestPlayers) != 1 || details.BestPlayers[0] != 4 {
+		t.Errorf("expected Catan to be best at 4, got %v", details.BestPlayers)
+	}
+	if len(details.GoodPlayers) != 1 || details.GoodPlayers[0] != 3 {
+		t.Errorf("expected Catan to be recommended at 3, got %v", details.GoodPlayers)
+	}
+	if len(details.Categories) != 2 || details.Categories[1] != "Negotiation" {
+		t.Errorf("expected Catan's categories to be parsed, got %v", details.Categories)
+	}
+	if len(details.Mechanics) != 1 || details.Mechanics[0] != "Dice Rolling" {
+		t.Errorf("expected Catan's mechanics to be parsed, got %v", details.Mechanics)
+	}
+}
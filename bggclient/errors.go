@@ -0,0 +1,46 @@
+package bggclient
+
+import (
+	"encoding/xml"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrUserNotFound is returned when BGG doesn't recognise a username
+	ErrUserNotFound = errors.New("bgg user not found")
+	// ErrGameNotFound is returned when BGG has no board game with an ID
+	ErrGameNotFound = errors.New("bgg game not found")
+	// ErrProcessing is returned when BGG is still preparing a collection after every retry, so the
+	// request may succeed if tried again later
+	ErrProcessing = errors.New("bgg is still processing the request")
+)
+
+// StatusError is returned when BGG responds with a status other than 200
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return "non-200 received from bgg: " + e.Body
+}
+
+// errorsRes is the body BGG responds with, alongside a 200, for requests it can't serve
+type errorsRes struct {
+	XMLName  xml.Name `xml:"errors"`
+	Messages []string `xml:"error>message"`
+}
+
+// parseErrors returns the error described by a BGG error body, or nil if the body isn't one
+func parseErrors(body []byte) error {
+	var res errorsRes
+	if xml.Unmarshal(body, &res) != nil || len(res.Messages) == 0 {
+		return nil
+	}
+	if strings.Contains(strings.ToLower(res.Messages[0]), "invalid username") {
+		return ErrUserNotFound
+	}
+	return errors.New("bgg returned an error: " + res.Messages[0])
+}
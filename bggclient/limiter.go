@@ -0,0 +1,53 @@
+package bggclient
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tylerdixon/bgchooser/config"
+)
+
+// baseURL is where the BGG XML API is requested from
+var baseURL = "https://boardgamegeek.com/xmlapi2"
+
+// rateLimit spaces out every request made to BGG
+var rateLimit = &limiter{interval: time.Second / 2}
+
+// Configure sets where BGG is requested from and how often. It should be called before any requests are made.
+func Configure(cfg config.BGGConfig) {
+	baseURL = strings.TrimSuffix(cfg.BaseURL, "/")
+	rateLimit = &limiter{interval: time.Duration(float64(time.Second) / cfg.RequestsPerSecond)}
+}
+
+// limiter spaces out requests so that no more than one is started per interval
+type limiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+// wait blocks until the next request may be made, or the context is done
+func (l *limiter) wait(ctx context.Context) error {
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	delay := l.next.Sub(now)
+	l.next = l.next.Add(l.interval)
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,26 @@
+package bggclient
+
+import (
+	"context"
+	. "testing"
+	"time"
+)
+
+func TestLimiterWait(t *T) {
+	l := &limiter{interval: 20 * time.Millisecond}
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := l.wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("expected 3 requests to be spaced over 40ms, took %v", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := l.wait(ctx); err != context.Canceled {
+		t.Errorf("expected waiting to stop once cancelled, got %v", err)
+	}
+}
@@ -0,0 +1,47 @@
+package bggclient
+
+import (
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	requestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "bgchooser",
+		Subsystem: "bgg",
+		Name:      "requests_total",
+		Help:      "Requests made to the BGG XML API, by endpoint and response status.",
+	}, []string{"endpoint", "status"})
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "bgchooser",
+		Subsystem: "bgg",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of requests to the BGG XML API, excluding time spent waiting on the rate limit.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"endpoint"})
+	retriesTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "bgchooser",
+		Subsystem: "bgg",
+		Name:      "collection_retries_total",
+		Help:      "Collection requests retried because BGG was still preparing the collection.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(requestsTotal, requestDuration, retriesTotal)
+}
+
+// observeRequest records a request to BGG, whose endpoint is the last element of its path, such as `thing`
+func observeRequest(req *http.Request, res *http.Response, err error, took time.Duration) {
+	endpoint := path.Base(req.URL.Path)
+	status := "error"
+	if err == nil {
+		status = strconv.Itoa(res.StatusCode)
+	}
+	requestsTotal.WithLabelValues(endpoint, status).Inc()
+	requestDuration.WithLabelValues(endpoint).Observe(took.Seconds())
+}
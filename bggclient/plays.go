@@ -0,0 +1,171 @@
+package bggclient
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// PlayDateFormat is the format BGG uses for the date of a play
+const PlayDateFormat = "2006-01-02"
+
+// maxPlayPages limits how many pages of plays are fetched for a single user, at 100 plays per page
+const maxPlayPages = 20
+
+// Plays represents a set of play-log records, as used by BGG's plays API and play import
+type Plays struct {
+	XMLName  xml.Name `xml:"plays"`
+	Username string   `xml:"username,attr,omitempty"`
+	Total    int      `xml:"total,attr"`
+	Page     int      `xml:"page,attr"`
+	Plays    []Play   `xml:"play"`
+}
+
+// Play represents a single logged play of a game
+type Play struct {
+	ID         string       `xml:"id,attr" json:"id"`
+	Date       string       `xml:"date,attr" json:"date"`
+	Quantity   int          `xml:"quantity,attr" json:"quantity"`
+	Length     int          `xml:"length,attr" json:"length"`
+	Incomplete int          `xml:"incomplete,attr" json:"incomplete"`
+	NoWinStats int          `xml:"nowinstats,attr" json:"nowinstats"`
+	Location   string       `xml:"location,attr" json:"location"`
+	Item       PlayItem     `xml:"item" json:"item"`
+	Players    []PlayPlayer `xml:"players>player" json:"players"`
+}
+
+// PlayItem represents the game a play was of
+type PlayItem struct {
+	Name       string `xml:"name,attr" json:"name"`
+	ObjectType string `xml:"objecttype,attr" json:"objecttype"`
+	ObjectID   string `xml:"objectid,attr" json:"objectid"`
+}
+
+// PlayPlayer represents one of the players in a play
+type PlayPlayer struct {
+	Username string `xml:"username,attr" json:"username"`
+	Name     string `xml:"name,attr" json:"name"`
+	New      int    `xml:"new,attr" json:"new"`
+	Win      int    `xml:"win,attr" json:"win"`
+}
+
+// PlayStats summarizes how often a game has been played and when it was last played
+type PlayStats struct {
+	Plays        int    `json:"plays"`
+	LastPlayed   string `json:"lastPlayed"`
+	LastPlayedBy string `json:"lastPlayedBy"`
+}
+
+// GetUserPlays retrieves every play of a board game that a user has logged since the given date,
+// following BGG's pagination of the plays API
+func GetUserPlays(ctx context.Context, username string, since time.Time) ([]Play, error) {
+	var plays []Play
+	for page := 1; page <= maxPlayPages; page++ {
+		reqString := baseURL + "/plays?username=" + url.QueryEscape(username) +
+			"&type=thing&subtype=boardgame&mindate=" + since.Format(PlayDateFormat) + "&page=" + strconv.Itoa(page)
+		res, err := get(ctx, reqString)
+		if err != nil {
+			return plays, err
+		}
+		body, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			return plays, err
+		}
+		if res.StatusCode != 200 {
+			return plays, &StatusError{res.StatusCode, string(body)}
+		}
+
+		var playsRes Plays
+		err = xml.Unmarshal(body, &playsRes)
+		if err != nil {
+			return plays, errors.Wrap(err, "failed to parse plays for user "+username)
+		}
+		plays = append(plays, playsRes.Plays...)
+		if len(playsRes.Plays) == 0 || len(plays) >= playsRes.Total {
+			break
+		}
+	}
+	return plays, nil
+}
+
+// SummarizePlays aggregates the plays of several users by game ID
+func SummarizePlays(userPlays map[string][]Play) map[string]PlayStats {
+	stats := make(map[string]PlayStats)
+	for username, plays := range userPlays {
+		for _, play := range plays {
+			stat := stats[play.Item.ObjectID]
+			quantity := play.Quantity
+			if quantity == 0 {
+				quantity = 1
+			}
+			stat.Plays += quantity
+			// Dates are formatted as YYYY-MM-DD, so they compare correctly as strings. Users who played
+			// on the same day are tied by username, so the result doesn't depend on map order.
+			if play.Date > stat.LastPlayed || (play.Date == stat.LastPlayed && username < stat.LastPlayedBy) {
+				stat.LastPlayed = play.Date
+				stat.LastPlayedBy = username
+			}
+			stats[play.Item.ObjectID] = stat
+		}
+	}
+	return stats
+}
+
+// EncodePlaysXML writes plays in the XML format of BGG's plays API
+func EncodePlaysXML(w io.Writer, plays Plays) error {
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	return enc.Encode(plays)
+}
+
+var playsCSVHeader = []string{"playid", "date", "objectid", "objectname", "quantity", "length", "incomplete", "nowinstats", "location", "players"}
+
+// EncodePlaysCSV writes plays as CSV with the columns of BGG's play export. Players are listed in a
+// single column separated by semicolons, each as their name followed by their BGG username if known.
+func EncodePlaysCSV(w io.Writer, plays Plays) error {
+	writer := csv.NewWriter(w)
+	err := writer.Write(playsCSVHeader)
+	if err != nil {
+		return err
+	}
+	for _, play := range plays.Plays {
+		var players []string
+		for _, player := range play.Players {
+			if player.Username != "" {
+				players = append(players, player.Name+" ("+player.Username+")")
+			} else {
+				players = append(players, player.Name)
+			}
+		}
+		err = writer.Write([]string{
+			play.ID,
+			play.Date,
+			play.Item.ObjectID,
+			play.Item.Name,
+			strconv.Itoa(play.Quantity),
+			strconv.Itoa(play.Length),
+			strconv.Itoa(play.Incomplete),
+			strconv.Itoa(play.NoWinStats),
+			play.Location,
+			strings.Join(players, ";"),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
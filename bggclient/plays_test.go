@@ -0,0 +1,191 @@
+package bggclient
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	. "testing"
+	"time"
+)
+
+var testPlays = Plays{
+	Total: 1,
+	Page:  1,
+	Plays: []Play{{
+		Date:     "2020-03-10",
+		Quantity: 1,
+		Item: PlayItem{
+			Name:       "Azul",
+			ObjectType: "thing",
+			ObjectID:   "230802",
+		},
+		Players: []PlayPlayer{
+			{Name: "Alice", Username: "alice42"},
+			{Name: "Bob"},
+		},
+	}},
+}
+
+func TestEncodePlaysXML(t *T) {
+	var buf bytes.Buffer
+	err := EncodePlaysXML(&buf, testPlays)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		`<play id="" date="2020-03-10" quantity="1"`,
+		`<item name="Azul" objecttype="thing" objectid="230802"></item>`,
+		`<player username="alice42" name="Alice" new="0" win="0"></player>`,
+	} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Errorf("expected XML to contain %s, got:\n%s", expected, buf.String())
+		}
+	}
+}
+
+func TestEncodePlaysCSV(t *T) {
+	var buf bytes.Buffer
+	err := EncodePlaysCSV(&buf, testPlays)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "playid,date,objectid,objectname,quantity,length,incomplete,nowinstats,location,players\n" +
+		",2020-03-10,230802,Azul,1,0,0,0,,Alice (alice42);Bob\n"
+	if buf.String() != expected {
+		t.Errorf("expected CSV:\n%s\ngot:\n%s", expected, buf.String())
+	}
+}
+
+func TestSummarizePlays(t *T) {
+	stats := SummarizePlays(map[string][]Play{
+		"alice42": {
+			{Date: "2020-01-05", Quantity: 2, Item: PlayItem{ObjectID: "230802"}},
+			{Date: "2019-12-24", Quantity: 1, Item: PlayItem{ObjectID: "13"}},
+		},
+		"bob7": {
+			{Date: "2020-02-14", Quantity: 1, Item: PlayItem{ObjectID: "230802"}},
+			{Date: "2019-12-24", Quantity: 1, Item: PlayItem{ObjectID: "13"}},
+		},
+	})
+
+	if azul := stats["230802"]; azul.Plays != 3 || azul.LastPlayed != "2020-02-14" || azul.LastPlayedBy != "bob7" {
+		t.Errorf("expected Azul to be played 3 times, last by bob7 on 2020-02-14, got %+v", azul)
+	}
+	if catan := stats["13"]; catan.Plays != 2 || catan.LastPlayedBy != "alice42" {
+		t.Errorf("expected Catan to be played twice, last by alice42 on the tied date, got %+v", catan)
+	}
+}
+
+// playsPages are the pages of plays served for alice42, who has logged three plays since 2020-01-01
+var playsPages = map[string]string{
+	"1": `<?xml version="1.0" encoding="utf-8"?>
+<plays username="alice42" userid="1" total="3" page="1" termsofuse="https://boardgamegeek.com/xmlapi/termsofuse">
+	<play id="101" date="2020-03-10" quantity="2" length="45" incomplete="0" nowinstats="0" location="Home">
+		<item name="Azul" objecttype="thing" objectid="230802">
+			<subtypes><subtype value="boardgame" /></subtypes>
+		</item>
+		<players>
+			<player username="alice42" userid="1" name="Alice" startposition="" color="" score="72" new="0" rating="0" win="1" />
+			<player username="" userid="0" name="Bob" startposition="" color="" score="64" new="1" rating="0" win="0" />
+		</players>
+	</play>
+	<play id="102" date="2020-02-01" quantity="1" length="0" incomplete="1" nowinstats="0" location="">
+		<item name="Catan" objecttype="thing" objectid="13">
+			<subtypes><subtype value="boardgame" /></subtypes>
+		</item>
+	</play>
+</plays>`,
+	"2": `<?xml version="1.0" encoding="utf-8"?>
+<plays username="alice42" userid="1" total="3" page="2" termsofuse="https://boardgamegeek.com/xmlapi/termsofuse">
+	<play id="103" date="2020-01-05" quantity="1" length="30" incomplete="0" nowinstats="0" location="">
+		<item name="Azul" objecttype="thing" objectid="230802">
+			<subtypes><subtype value="boardgame" /></subtypes>
+		</item>
+	</play>
+</plays>`,
+}
+
+// serveBGG points the client at a test server for the duration of a test, without rate limiting it
+func serveBGG(t *T, handler http.HandlerFunc) {
+	server := httptest.NewServer(handler)
+	oldBaseURL, oldRateLimit := baseURL, rateLimit
+	baseURL, rateLimit = server.URL, &limiter{}
+	t.Cleanup(func() {
+		server.Close()
+		baseURL, rateLimit = oldBaseURL, oldRateLimit
+	})
+}
+
+func TestGetUserPlays(t *T) {
+	var pages []string
+	serveBGG(t, func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if r.URL.Path != "/plays" || query.Get("username") != "alice42" || query.Get("mindate") != "2020-01-01" ||
+			query.Get("type") != "thing" || query.Get("subtype") != "boardgame" {
+			t.Errorf("unexpected request for %s", r.URL)
+		}
+		pages = append(pages, query.Get("page"))
+		w.Write([]byte(playsPages[query.Get("page")]))
+	})
+
+	plays, err := GetUserPlays(context.Background(), "alice42", time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(pages, ",") != "1,2" {
+		t.Errorf("expected pages 1 and 2 to be requested, got %v", pages)
+	}
+	if len(plays) != 3 || plays[0].ID != "101" || plays[2].ID != "103" {
+		t.Fatalf("expected the 3 plays across both pages, got %+v", plays)
+	}
+	azul := plays[0]
+	if azul.Date != "2020-03-10" || azul.Quantity != 2 || azul.Length != 45 || azul.Location != "Home" {
+		t.Errorf("expected the play's details to be parsed, got %+v", azul)
+	}
+	if azul.Item.Name != "Azul" || azul.Item.ObjectID != "230802" {
+		t.Errorf("expected the play to be of Azul, got %+v", azul.Item)
+	}
+	if len(azul.Players) != 2 || azul.Players[0].Username != "alice42" || azul.Players[0].Win != 1 || azul.Players[1].New != 1 {
+		t.Errorf("expected the play's players to be parsed, got %+v", azul.Players)
+	}
+	if catan := plays[1]; catan.Incomplete != 1 || len(catan.Players) != 0 {
+		t.Errorf("expected an incomplete play without players, got %+v", catan)
+	}
+}
+
+func TestGetUserPlaysStopsOnEmptyPage(t *T) {
+	requests := 0
+	serveBGG(t, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		// BGG's total can count plays that aren't returned, such as those of other types of game
+		w.Write([]byte(`<plays username="alice42" total="150" page="1"></plays>`))
+	})
+
+	plays, err := GetUserPlays(context.Background(), "alice42", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plays) != 0 || requests != 1 {
+		t.Errorf("expected a single request for no plays, got %d requests for %+v", requests, plays)
+	}
+}
+
+func TestGetUserPlaysErrors(t *T) {
+	serveBGG(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("username") == "busy" {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte(`<plays`))
+	})
+
+	_, err := GetUserPlays(context.Background(), "busy", time.Now())
+	if statusErr, ok := err.(*StatusError); !ok || statusErr.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("expected a 429 status error, got %v", err)
+	}
+	if _, err := GetUserPlays(context.Background(), "alice42", time.Now()); err == nil {
+		t.Error("expected malformed plays to fail to parse")
+	}
+}
@@ -0,0 +1,139 @@
+package chooser
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/tylerdixon/bgchooser/bggclient"
+	"github.com/tylerdixon/bgchooser/storage"
+)
+
+// SortOrder represents the order a room's games are listed in, matching the orders offered by the web UI
+type SortOrder string
+
+const (
+	SortAlphaAsc     SortOrder = "alpha"
+	SortAlphaDesc    SortOrder = "alphaDesc"
+	SortPlaytimeAsc  SortOrder = "playtime"
+	SortPlaytimeDesc SortOrder = "playtimeDesc"
+	SortVotesDesc    SortOrder = "votes"
+	// SortLastPlayedAsc lists the games that have gone longest without being played first, after those
+	// that have never been played
+	SortLastPlayedAsc SortOrder = "lastPlayed"
+)
+
+// ValidSortOrder returns whether a sort order is one of the supported orders
+func ValidSortOrder(order SortOrder) bool {
+	switch order {
+	case SortAlphaAsc, SortAlphaDesc, SortPlaytimeAsc, SortPlaytimeDesc, SortVotesDesc, SortLastPlayedAsc:
+		return true
+	}
+	return false
+}
+
+// GameFilter describes which of a room's games to list. Zero values match every game.
+type GameFilter struct {
+	Players     int
+	MaxPlaytime int
+	MinWeight   float64
+	MaxWeight   float64
+	// Owner is the user whose collection the game must be in
+	Owner string
+	// Categories and Mechanics must all be present on a game, ignoring case
+	Categories []string
+	Mechanics  []string
+}
+
+// NeedsDetails returns whether the filter relies on the community statistics fetched separately from BGG
+func (f GameFilter) NeedsDetails() bool {
+	return f.MinWeight > 0 || f.MaxWeight > 0 || len(f.Categories) > 0 || len(f.Mechanics) > 0
+}
+
+func containsAllFold(list, required []string) bool {
+	for _, r := range required {
+		found := false
+		for _, l := range list {
+			if strings.EqualFold(l, r) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// FilterGames returns the unique games that match the filter. owners lists the users whose collections
+// each game is in, keyed by game ID, and details holds each game's community statistics.
+func FilterGames(games []bggclient.Game, filter GameFilter, owners map[string][]string, details map[string]bggclient.GameDetails) []bggclient.Game {
+	seen := make(map[string]bool)
+	filtered := []bggclient.Game{}
+	for _, game := range games {
+		if seen[game.ID] {
+			continue
+		}
+		seen[game.ID] = true
+		d := details[game.ID]
+		if !fitsPlayers(game, filter.Players) {
+			continue
+		}
+		if filter.MaxPlaytime > 0 && game.Info.MaxPlaytime > filter.MaxPlaytime {
+			continue
+		}
+		if filter.MinWeight > 0 && d.Weight < filter.MinWeight {
+			continue
+		}
+		if filter.MaxWeight > 0 && (d.Weight == 0 || d.Weight > filter.MaxWeight) {
+			continue
+		}
+		if filter.Owner != "" && !contains(owners[game.ID], filter.Owner) {
+			continue
+		}
+		if !containsAllFold(d.Categories, filter.Categories) || !containsAllFold(d.Mechanics, filter.Mechanics) {
+			continue
+		}
+		filtered = append(filtered, game)
+	}
+	return filtered
+}
+
+// averagePlaytime is what games are sorted by for playtime, as in the web UI
+func averagePlaytime(game bggclient.Game) float64 {
+	return float64(game.Info.MinPlaytime+game.Info.MaxPlaytime) / 2
+}
+
+// SortGames orders games in place. plays summarizes when each game was last played, keyed by game ID,
+// and is only needed to sort by when games were last played. Games that compare equal are ordered by name.
+func SortGames(games []bggclient.Game, order SortOrder, tally []storage.GameTally, plays map[string]bggclient.PlayStats) {
+	votes := make(map[string]int)
+	for _, t := range tally {
+		votes[t.GameID] = t.Votes
+	}
+	sort.SliceStable(games, func(i, j int) bool {
+		a, b := games[i], games[j]
+		switch order {
+		case SortAlphaDesc:
+			return strings.ToLower(a.Name) > strings.ToLower(b.Name)
+		case SortPlaytimeAsc:
+			if averagePlaytime(a) != averagePlaytime(b) {
+				return averagePlaytime(a) < averagePlaytime(b)
+			}
+		case SortPlaytimeDesc:
+			if averagePlaytime(a) != averagePlaytime(b) {
+				return averagePlaytime(a) > averagePlaytime(b)
+			}
+		case SortVotesDesc:
+			if votes[a.ID] != votes[b.ID] {
+				return votes[a.ID] > votes[b.ID]
+			}
+		case SortLastPlayedAsc:
+			// Dates are formatted as YYYY-MM-DD, and are empty for games never played, so they compare as strings
+			if plays[a.ID].LastPlayed != plays[b.ID].LastPlayed {
+				return plays[a.ID].LastPlayed < plays[b.ID].LastPlayed
+			}
+		}
+		return strings.ToLower(a.Name) < strings.ToLower(b.Name)
+	})
+}
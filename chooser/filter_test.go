@@ -0,0 +1,78 @@
+package chooser
+
+import (
+	. "testing"
+
+	"github.com/tylerdixon/bgchooser/bggclient"
+	"github.com/tylerdixon/bgchooser/storage"
+)
+
+var filterGames = []bggclient.Game{
+	{ID: "1", Name: "Azul", Info: bggclient.GameInfo{MinPlayers: 2, MaxPlayers: 4, MinPlaytime: 30, MaxPlaytime: 45}},
+	{ID: "2", Name: "Catan", Info: bggclient.GameInfo{MinPlayers: 3, MaxPlayers: 4, MinPlaytime: 60, MaxPlaytime: 120}},
+	{ID: "3", Name: "Root", Info: bggclient.GameInfo{MinPlayers: 2, MaxPlayers: 4, MinPlaytime: 60, MaxPlaytime: 90}},
+	{ID: "4", Name: "Codenames", Info: bggclient.GameInfo{MinPlayers: 4, MaxPlayers: 8, MinPlaytime: 15, MaxPlaytime: 15}},
+	{ID: "1", Name: "Azul", Info: bggclient.GameInfo{MinPlayers: 2, MaxPlayers: 4, MinPlaytime: 30, MaxPlaytime: 45}},
+}
+
+func gameIDs(games []bggclient.Game) string {
+	ids := ""
+	for _, game := range games {
+		ids += game.ID
+	}
+	return ids
+}
+
+func TestFilterGames(t *T) {
+	owners := map[string][]string{"1": {"alice"}, "2": {"alice", "bob"}, "3": {"bob"}, "4": {"carol"}}
+	details := map[string]bggclient.GameDetails{
+		"1": {Weight: 1.8, Categories: []string{"Abstract Strategy"}, Mechanics: []string{"Tile Placement"}},
+		"2": {Weight: 2.3, Categories: []string{"Economic", "Negotiation"}, Mechanics: []string{"Dice Rolling", "Trading"}},
+		"3": {Weight: 3.7, Categories: []string{"Wargame"}},
+		"4": {Weight: 1.3, Categories: []string{"Party Game"}},
+	}
+
+	tests := []struct {
+		filter   GameFilter
+		expected string
+	}{
+		{GameFilter{}, "1234"},
+		{GameFilter{Players: 3}, "123"},
+		{GameFilter{MaxPlaytime: 90}, "134"},
+		{GameFilter{MinWeight: 2, MaxWeight: 3}, "2"},
+		{GameFilter{Owner: "alice"}, "12"},
+		{GameFilter{Categories: []string{"negotiation"}, Mechanics: []string{"Trading", "Dice Rolling"}}, "2"},
+		{GameFilter{Mechanics: []string{"Trading", "Tile Placement"}}, ""},
+	}
+	for _, test := range tests {
+		if ids := gameIDs(FilterGames(filterGames, test.filter, owners, details)); ids != test.expected {
+			t.Errorf("expected %+v to match %q, got %q", test.filter, test.expected, ids)
+		}
+	}
+}
+
+func TestSortGames(t *T) {
+	tally := []storage.GameTally{{GameID: "3", Votes: 2}, {GameID: "4", Votes: 2}, {GameID: "2", Votes: 1}}
+	plays := map[string]bggclient.PlayStats{
+		"1": {Plays: 4, LastPlayed: "2020-02-14"},
+		"3": {Plays: 1, LastPlayed: "2019-06-01"},
+	}
+	tests := []struct {
+		order    SortOrder
+		expected string
+	}{
+		{SortAlphaAsc, "1243"},
+		{SortAlphaDesc, "3421"},
+		{SortPlaytimeAsc, "4132"},
+		{SortPlaytimeDesc, "2314"},
+		{SortVotesDesc, "4321"},
+		{SortLastPlayedAsc, "2431"},
+	}
+	for _, test := range tests {
+		games := FilterGames(filterGames, GameFilter{}, nil, nil)
+		SortGames(games, test.order, tally, plays)
+		if ids := gameIDs(games); ids != test.expected {
+			t.Errorf("expected %s to sort games as %q, got %q", test.order, test.expected, ids)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package chooser
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"sort"
+
+	"github.com/tylerdixon/bgchooser/bggclient"
+	"github.com/tylerdixon/bgchooser/storage"
+)
+
+var ErrNoPickCandidates = errors.New("no games can be picked")
+
+// PickCandidate represents a game that could have been picked, along with its chances
+type PickCandidate struct {
+	GameID string `json:"gameID"`
+	Weight int    `json:"weight"`
+}
+
+// PickResult represents a random pick, with everything needed to verify it. Anyone can check that
+// the SHA-256 hash of the seed matches the commitment published before the pick, then repeat the
+// draw: Roll is the first 8 bytes of the seed's hash as a big endian integer, modulo the total
+// weight, and the picked game is the candidate whose cumulative weight first exceeds it.
+type PickResult struct {
+	GameID     string          `json:"gameID"`
+	Seed       string          `json:"seed"`
+	Commitment string          `json:"commitment"`
+	Candidates []PickCandidate `json:"candidates"`
+	Roll       uint64          `json:"roll"`
+}
+
+// Commitment returns the value that is published in advance for a seed, so it can't be changed once a pick is made
+func Commitment(seed string) string {
+	sum := sha256.Sum256([]byte(seed))
+	return hex.EncodeToString(sum[:])
+}
+
+// Pick randomly selects a game using the given seed, leaving out vetoed games, games that don't
+// support the player count and, in a runoff, games that aren't among the round's candidates. Every
+// game may be picked when no round candidates are given. Candidates are ordered by ID and weighted by
+// their votes, unless nobody voted for any of them, in which case each is equally likely.
+func Pick(games []bggclient.Game, tally []storage.GameTally, roundCandidates []string, players int, seed string) (PickResult, error) {
+	tallies := make(map[string]storage.GameTally)
+	for _, t := range tally {
+		tallies[t.GameID] = t
+	}
+	inRound := make(map[string]bool)
+	for _, gameID := range roundCandidates {
+		inRound[gameID] = true
+	}
+
+	seen := make(map[string]bool)
+	var candidates []PickCandidate
+	total := 0
+	for _, game := range games {
+		t := tallies[game.ID]
+		if seen[game.ID] || t.Vetoes > 0 || !fitsPlayers(game, players) {
+			continue
+		}
+		if len(inRound) > 0 && !inRound[game.ID] {
+			continue
+		}
+		seen[game.ID] = true
+		candidates = append(candidates, PickCandidate{
+			GameID: game.ID,
+			Weight: t.Votes,
+		})
+		total += t.Votes
+	}
+	if len(candidates) == 0 {
+		return PickResult{}, ErrNoPickCandidates
+	}
+	if total == 0 {
+		for i := range candidates {
+			candidates[i].Weight = 1
+		}
+		total = len(candidates)
+	} else {
+		var weighted []PickCandidate
+		for _, c := range candidates {
+			if c.Weight > 0 {
+				weighted = append(weighted, c)
+			}
+		}
+		candidates = weighted
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].GameID < candidates[j].GameID
+	})
+
+	sum := sha256.Sum256([]byte(seed))
+	res := PickResult{
+		Seed:       seed,
+		Commitment: hex.EncodeToString(sum[:]),
+		Candidates: candidates,
+		Roll:       binary.BigEndian.Uint64(sum[:8]) % uint64(total),
+	}
+	cumulative := uint64(0)
+	for _, c := range candidates {
+		cumulative += uint64(c.Weight)
+		if res.Roll < cumulative {
+			res.GameID = c.GameID
+			break
+		}
+	}
+	return res, nil
+}
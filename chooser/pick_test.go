@@ -0,0 +1,63 @@
+package chooser
+
+import (
+	. "testing"
+
+	"github.com/tylerdixon/bgchooser/bggclient"
+	"github.com/tylerdixon/bgchooser/storage"
+)
+
+func TestPick(t *T) {
+	games := []bggclient.Game{
+		{ID: "1", Info: bggclient.GameInfo{MinPlayers: 2, MaxPlayers: 4}},
+		{ID: "2", Info: bggclient.GameInfo{MinPlayers: 2, MaxPlayers: 4}},
+		{ID: "3", Info: bggclient.GameInfo{MinPlayers: 2, MaxPlayers: 4}},
+		{ID: "4", Info: bggclient.GameInfo{MinPlayers: 5, MaxPlayers: 8}},
+		{ID: "5", Info: bggclient.GameInfo{MinPlayers: 2, MaxPlayers: 4}},
+	}
+	tally := []storage.GameTally{
+		{GameID: "1", Votes: 3},
+		{GameID: "2", Votes: 1},
+		{GameID: "3", Votes: 4, Vetoes: 1},
+		{GameID: "4", Votes: 5},
+	}
+
+	res, err := Pick(games, tally, nil, 4, "seed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Candidates) != 2 || res.Candidates[0] != (PickCandidate{"1", 3}) || res.Candidates[1] != (PickCandidate{"2", 1}) {
+		t.Errorf("expected only games 1 and 2 to be weighted candidates, got %+v", res.Candidates)
+	}
+	if res.Commitment != Commitment("seed") || res.Roll >= 4 {
+		t.Errorf("unexpected commitment or roll: %+v", res)
+	}
+	expected := "1"
+	if res.Roll == 3 {
+		expected = "2"
+	}
+	if res.GameID != expected {
+		t.Errorf("expected roll %d to pick %s, got %s", res.Roll, expected, res.GameID)
+	}
+
+	again, _ := Pick(games, tally, nil, 4, "seed")
+	if again.GameID != res.GameID || again.Roll != res.Roll {
+		t.Errorf("expected the same seed to pick the same game, got %+v and %+v", res, again)
+	}
+
+	if _, err := Pick(games, []storage.GameTally{{GameID: "1", Vetoes: 1}}, nil, 6, "seed"); err != nil {
+		t.Errorf("expected game 4 to be picked without votes, got %v", err)
+	}
+	if _, err := Pick(games, nil, nil, 9, "seed"); err != ErrNoPickCandidates {
+		t.Errorf("expected no candidates for 9 players, got %v", err)
+	}
+
+	// Games eliminated from a runoff can't be picked, even when nobody has voted in it yet
+	runoff, err := Pick(games, nil, []string{"2", "5"}, 4, "seed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runoff.Candidates) != 2 || runoff.Candidates[0] != (PickCandidate{"2", 1}) || runoff.Candidates[1] != (PickCandidate{"5", 1}) {
+		t.Errorf("expected only the runoff's games to be equally likely, got %+v", runoff.Candidates)
+	}
+}
@@ -0,0 +1,133 @@
+package chooser
+
+import (
+	"sort"
+
+	"github.com/tylerdixon/bgchooser/bggclient"
+	"github.com/tylerdixon/bgchooser/storage"
+)
+
+const (
+	// maxPlanCandidates limits how many of the most voted games are combined into plans
+	maxPlanCandidates = 20
+	// maxPlanGames limits how many games a single plan can have
+	maxPlanGames = 5
+)
+
+// PlanOptions describes the evening that plans are made for
+type PlanOptions struct {
+	// Minutes is how long the group has to play in total
+	Minutes int
+	// Players is how many people will play, with 0 allowing any player count
+	Players int
+	Limit   int
+}
+
+// Plan represents a set of games that fit within an evening
+type Plan struct {
+	Games      []bggclient.Game `json:"games"`
+	Votes      int              `json:"votes"`
+	MinMinutes int              `json:"minMinutes"`
+	MaxMinutes int              `json:"maxMinutes"`
+}
+
+type planCandidate struct {
+	game       bggclient.Game
+	votes      int
+	minMinutes int
+	maxMinutes int
+}
+
+// PlanEvening finds the combinations of games that fit within the evening even if each takes its maximum
+// playtime, ordered by the total votes they received. Vetoed games and games nobody voted for are left
+// out. Between plans with the same votes, those that use more of the evening come first.
+func PlanEvening(games []bggclient.Game, tally []storage.GameTally, opts PlanOptions) []Plan {
+	tallies := make(map[string]storage.GameTally)
+	for _, t := range tally {
+		tallies[t.GameID] = t
+	}
+
+	seen := make(map[string]bool)
+	var candidates []planCandidate
+	for _, game := range games {
+		t := tallies[game.ID]
+		if seen[game.ID] || t.Votes == 0 || t.Vetoes > 0 || !fitsPlayers(game, opts.Players) {
+			continue
+		}
+		seen[game.ID] = true
+		c := planCandidate{
+			game:       game,
+			votes:      t.Votes,
+			minMinutes: game.Info.MinPlaytime,
+			maxMinutes: game.Info.MaxPlaytime,
+		}
+		if c.minMinutes == 0 {
+			c.minMinutes = c.maxMinutes
+		}
+		if c.maxMinutes < c.minMinutes {
+			c.maxMinutes = c.minMinutes
+		}
+		// Games without a playtime can't be planned around
+		if c.maxMinutes == 0 || c.maxMinutes > opts.Minutes {
+			continue
+		}
+		candidates = append(candidates, c)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].votes != candidates[j].votes {
+			return candidates[i].votes > candidates[j].votes
+		}
+		return candidates[i].game.ID < candidates[j].game.ID
+	})
+	if len(candidates) > maxPlanCandidates {
+		candidates = candidates[:maxPlanCandidates]
+	}
+
+	var plans []Plan
+	var current []planCandidate
+	var search func(start, minutes int)
+	search = func(start, minutes int) {
+		if len(current) > 0 {
+			plans = append(plans, newPlan(current))
+		}
+		if len(current) == maxPlanGames {
+			return
+		}
+		for i := start; i < len(candidates); i++ {
+			if minutes+candidates[i].maxMinutes > opts.Minutes {
+				continue
+			}
+			current = append(current, candidates[i])
+			search(i+1, minutes+candidates[i].maxMinutes)
+			current = current[:len(current)-1]
+		}
+	}
+	search(0, 0)
+
+	sort.SliceStable(plans, func(i, j int) bool {
+		if plans[i].Votes != plans[j].Votes {
+			return plans[i].Votes > plans[j].Votes
+		}
+		if plans[i].MaxMinutes != plans[j].MaxMinutes {
+			return plans[i].MaxMinutes > plans[j].MaxMinutes
+		}
+		return len(plans[i].Games) < len(plans[j].Games)
+	})
+	if opts.Limit > 0 && len(plans) > opts.Limit {
+		plans = plans[:opts.Limit]
+	}
+	return plans
+}
+
+func newPlan(candidates []planCandidate) Plan {
+	plan := Plan{
+		Games: make([]bggclient.Game, len(candidates)),
+	}
+	for i, c := range candidates {
+		plan.Games[i] = c.game
+		plan.Votes += c.votes
+		plan.MinMinutes += c.minMinutes
+		plan.MaxMinutes += c.maxMinutes
+	}
+	return plan
+}
@@ -0,0 +1,54 @@
+package chooser
+
+import (
+	. "testing"
+
+	"github.com/tylerdixon/bgchooser/bggclient"
+	"github.com/tylerdixon/bgchooser/storage"
+)
+
+func TestPlanEvening(t *T) {
+	games := []bggclient.Game{
+		{ID: "1", Name: "Azul", Info: bggclient.GameInfo{MinPlaytime: 30, MaxPlaytime: 45}},
+		{ID: "2", Name: "Catan", Info: bggclient.GameInfo{MinPlaytime: 60, MaxPlaytime: 120}},
+		{ID: "3", Name: "Root", Info: bggclient.GameInfo{MinPlaytime: 60, MaxPlaytime: 90}},
+		{ID: "4", Name: "Gloomhaven", Info: bggclient.GameInfo{MinPlaytime: 60, MaxPlaytime: 120}},
+		{ID: "5", Name: "Twilight Imperium", Info: bggclient.GameInfo{MinPlaytime: 240, MaxPlaytime: 480}},
+		{ID: "6", Name: "Codenames", Info: bggclient.GameInfo{MinPlaytime: 15, MaxPlaytime: 15}},
+	}
+	tally := []storage.GameTally{
+		{GameID: "1", Votes: 2},
+		{GameID: "2", Votes: 3},
+		{GameID: "3", Votes: 3},
+		{GameID: "4", Votes: 5, Vetoes: 1},
+		{GameID: "5", Votes: 4},
+	}
+
+	plans := PlanEvening(games, tally, PlanOptions{Minutes: 150})
+	if len(plans) == 0 {
+		t.Fatal("expected plans")
+	}
+	// Catan with Azul would only fit if both took their minimum playtime
+	best := plans[0]
+	if best.Votes != 5 || len(best.Games) != 2 || best.Games[0].ID != "3" || best.Games[1].ID != "1" || best.MaxMinutes != 135 {
+		t.Errorf("expected the best plan to be Root and Azul with 5 votes, got %+v", best)
+	}
+	for _, plan := range plans {
+		if plan.MaxMinutes > 150 {
+			t.Errorf("expected every plan to fit at its maximum playtime, got %+v", plan)
+		}
+		for _, game := range plan.Games {
+			if game.ID == "4" || game.ID == "5" || game.ID == "6" {
+				t.Errorf("expected vetoed, unvoted and overlong games to be left out, got %+v", plan)
+			}
+		}
+	}
+
+	for _, plan := range PlanEvening(games, tally, PlanOptions{Minutes: 90}) {
+		for _, game := range plan.Games {
+			if game.ID == "2" {
+				t.Errorf("expected Catan to be left out as it may run over, got %+v", plan)
+			}
+		}
+	}
+}
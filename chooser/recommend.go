@@ -0,0 +1,143 @@
+// Package chooser suggests which of a room's games to play, based on the data gathered from BGG and the room's votes
+package chooser
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/tylerdixon/bgchooser/bggclient"
+	"github.com/tylerdixon/bgchooser/storage"
+)
+
+const (
+	// bestPlayersBonus is added to the score of games the BGG community votes best at the requested player count
+	bestPlayersBonus = 1.5
+	// goodPlayersBonus is added to the score of games the BGG community recommends at the requested player count
+	goodPlayersBonus = 0.5
+)
+
+// RecommendOptions describes the group that recommendations are made for
+type RecommendOptions struct {
+	// Players is how many people will play, with 0 allowing any player count
+	Players int
+	// Minutes is how long the group has to play, with 0 allowing any playtime
+	Minutes int
+	// Members are the users present, whose ratings are taken into account. Every user's rating is used if none are given.
+	Members []string
+	// Names are what raters are called in the reasons given, keyed by the user their ratings are stored under. Users without a name are called by that user.
+	Names map[string]string
+	Limit int
+}
+
+// Recommendation represents a game suggested for a room, along with the reasons it was suggested
+type Recommendation struct {
+	Game    bggclient.Game `json:"game"`
+	Score   float64        `json:"score"`
+	Reasons []string       `json:"reasons"`
+}
+
+// fitsPlayers returns whether a game supports the given number of players. Games missing a player range always fit.
+func fitsPlayers(game bggclient.Game, players int) bool {
+	if players == 0 || game.Info.MaxPlayers == 0 {
+		return true
+	}
+	return players >= game.Info.MinPlayers && players <= game.Info.MaxPlayers
+}
+
+// fitsMinutes returns whether a game can be played within the given number of minutes, going by the
+// longest it may take
+func fitsMinutes(game bggclient.Game, minutes int) bool {
+	if minutes == 0 {
+		return true
+	}
+	playtime := game.Info.MaxPlaytime
+	if playtime == 0 {
+		playtime = game.Info.MinPlaytime
+	}
+	return playtime <= minutes
+}
+
+func containsInt(list []int, i int) bool {
+	for _, l := range list {
+		if l == i {
+			return true
+		}
+	}
+	return false
+}
+
+// Recommend scores the games that fit the group's player count and time budget. Games are scored by
+// the mean rating the present members gave them, falling back to BGG's average when none of them
+// have rated it, with a bonus for games the BGG community considers best at the player count.
+func Recommend(games []bggclient.Game, details map[string]bggclient.GameDetails, ratings map[string]storage.GroupRating, opts RecommendOptions) []Recommendation {
+	present := make(map[string]bool)
+	for _, member := range opts.Members {
+		present[member] = true
+	}
+
+	seen := make(map[string]bool)
+	recommendations := []Recommendation{}
+	for _, game := range games {
+		if seen[game.ID] || !fitsPlayers(game, opts.Players) || !fitsMinutes(game, opts.Minutes) {
+			continue
+		}
+		seen[game.ID] = true
+		d := details[game.ID]
+		rec := Recommendation{
+			Game:    game,
+			Reasons: []string{},
+		}
+
+		if opts.Players > 0 && containsInt(d.BestPlayers, opts.Players) {
+			rec.Score += bestPlayersBonus
+			rec.Reasons = append(rec.Reasons, fmt.Sprintf("best at %d", opts.Players))
+		} else if opts.Players > 0 && containsInt(d.GoodPlayers, opts.Players) {
+			rec.Score += goodPlayersBonus
+			rec.Reasons = append(rec.Reasons, fmt.Sprintf("recommended at %d", opts.Players))
+		}
+		if d.Weight > 0 {
+			rec.Reasons = append(rec.Reasons, fmt.Sprintf("avg weight %.1f", d.Weight))
+		}
+
+		var total float64
+		var rated int
+		var topRater string
+		for user, rating := range ratings[game.ID].Ratings {
+			if len(present) > 0 && !present[user] {
+				continue
+			}
+			total += rating
+			rated++
+			if topRater == "" || rating > ratings[game.ID].Ratings[topRater] || (rating == ratings[game.ID].Ratings[topRater] && user < topRater) {
+				topRater = user
+			}
+		}
+		if rated > 0 {
+			rec.Score += total / float64(rated)
+			rater := topRater
+			if name, ok := opts.Names[topRater]; ok {
+				rater = name
+			}
+			rec.Reasons = append(rec.Reasons, fmt.Sprintf("%s rated %g", rater, ratings[game.ID].Ratings[topRater]))
+		} else if average := d.AverageRating; average > 0 {
+			rec.Score += average
+			rec.Reasons = append(rec.Reasons, fmt.Sprintf("BGG average %.1f", average))
+		} else if average := game.Info.AverageRating; average > 0 {
+			rec.Score += average
+			rec.Reasons = append(rec.Reasons, fmt.Sprintf("BGG average %.1f", average))
+		}
+
+		recommendations = append(recommendations, rec)
+	}
+
+	sort.SliceStable(recommendations, func(i, j int) bool {
+		if recommendations[i].Score != recommendations[j].Score {
+			return recommendations[i].Score > recommendations[j].Score
+		}
+		return recommendations[i].Game.Name < recommendations[j].Game.Name
+	})
+	if opts.Limit > 0 && len(recommendations) > opts.Limit {
+		recommendations = recommendations[:opts.Limit]
+	}
+	return recommendations
+}
@@ -0,0 +1,76 @@
+package chooser
+
+import (
+	. "testing"
+
+	"github.com/tylerdixon/bgchooser/bggclient"
+	"github.com/tylerdixon/bgchooser/storage"
+)
+
+func TestFitsMinutes(t *T) {
+	tests := []struct {
+		info    bggclient.GameInfo
+		minutes int
+		fits    bool
+	}{
+		{bggclient.GameInfo{MinPlaytime: 60, MaxPlaytime: 120}, 90, false},
+		{bggclient.GameInfo{MinPlaytime: 60, MaxPlaytime: 120}, 120, true},
+		{bggclient.GameInfo{MinPlaytime: 60}, 90, true},
+		{bggclient.GameInfo{MaxPlaytime: 120}, 90, false},
+		{bggclient.GameInfo{}, 30, true},
+		{bggclient.GameInfo{MinPlaytime: 60, MaxPlaytime: 120}, 0, true},
+	}
+	for _, test := range tests {
+		if fits := fitsMinutes(bggclient.Game{Info: test.info}, test.minutes); fits != test.fits {
+			t.Errorf("expected %+v fitting in %d minutes to be %v, got %v", test.info, test.minutes, test.fits, fits)
+		}
+	}
+}
+
+func TestRecommend(t *T) {
+	games := []bggclient.Game{
+		{ID: "1", Name: "Azul", Info: bggclient.GameInfo{MinPlayers: 2, MaxPlayers: 4, MinPlaytime: 30, MaxPlaytime: 45}},
+		{ID: "2", Name: "Catan", Info: bggclient.GameInfo{MinPlayers: 3, MaxPlayers: 4, MinPlaytime: 60, MaxPlaytime: 120}},
+		{ID: "3", Name: "Root", Info: bggclient.GameInfo{MinPlayers: 2, MaxPlayers: 4, MinPlaytime: 60, MaxPlaytime: 90, AverageRating: 8.1}},
+		{ID: "4", Name: "Gloomhaven", Info: bggclient.GameInfo{MinPlayers: 1, MaxPlayers: 4, MinPlaytime: 60, MaxPlaytime: 120}},
+		{ID: "5", Name: "Codenames", Info: bggclient.GameInfo{MinPlayers: 4, MaxPlayers: 8, MinPlaytime: 15, MaxPlaytime: 15}},
+		{ID: "1", Name: "Azul"},
+	}
+	details := map[string]bggclient.GameDetails{
+		"1": {BestPlayers: []int{2}, GoodPlayers: []int{3}, Weight: 1.77},
+		"2": {BestPlayers: []int{4}, Weight: 2.32},
+		"4": {BestPlayers: []int{3}, Weight: 3.86},
+	}
+	ratings := map[string]storage.GroupRating{
+		"1": {Ratings: map[string]float64{"alex": 7, "sam": 9}},
+		"2": {Ratings: map[string]float64{"alex": 6, "jo": 10}},
+	}
+
+	recs := Recommend(games, details, ratings, RecommendOptions{
+		Players: 3,
+		Minutes: 120,
+		Members: []string{"alex", "sam"},
+		Names:   map[string]string{"sam": "Sam"},
+	})
+
+	expected := []string{"Azul", "Root", "Catan", "Gloomhaven"}
+	if len(recs) != len(expected) {
+		t.Fatalf("expected %d recommendations, got %+v", len(expected), recs)
+	}
+	for i, name := range expected {
+		if recs[i].Game.Name != name {
+			t.Errorf("expected recommendation %d to be %s, got %s", i, name, recs[i].Game.Name)
+		}
+	}
+
+	azul := recs[0]
+	if azul.Score != 8.5 {
+		t.Errorf("expected Azul to score 8.5, got %v", azul.Score)
+	}
+	if len(azul.Reasons) != 3 || azul.Reasons[0] != "recommended at 3" || azul.Reasons[1] != "avg weight 1.8" || azul.Reasons[2] != "Sam rated 9" {
+		t.Errorf("unexpected reasons for Azul: %v", azul.Reasons)
+	}
+	if catan := recs[2]; catan.Reasons[len(catan.Reasons)-1] != "alex rated 6" {
+		t.Errorf("expected only present members' ratings to count for Catan, got %v", catan.Reasons)
+	}
+}
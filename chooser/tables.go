@@ -0,0 +1,230 @@
+package chooser
+
+import (
+	"sort"
+
+	"github.com/tylerdixon/bgchooser/bggclient"
+	"github.com/tylerdixon/bgchooser/storage"
+)
+
+const (
+	// maxTableCandidates limits how many of the most voted games are considered for tables
+	maxTableCandidates = 10
+	// MaxTables limits how many tables a group can be split into
+	MaxTables = 4
+)
+
+// Table represents a game and the members who will play it
+type Table struct {
+	Game         bggclient.Game `json:"game"`
+	Members      []string       `json:"members"`
+	Satisfaction int            `json:"satisfaction"`
+}
+
+// TableSplit represents a way of splitting members into tables that play at the same time.
+// Satisfaction counts the members who are playing a game they voted for.
+type TableSplit struct {
+	Tables       []Table `json:"tables"`
+	Satisfaction int     `json:"satisfaction"`
+}
+
+// SplitTables proposes ways of splitting members into the given number of tables, each playing a
+// different game that supports its number of players. Nobody is seated at a game they vetoed, and
+// splits are ordered by how many members get to play a game they voted for.
+func SplitTables(games []bggclient.Game, votes storage.VoteResult, members []string, tables, limit int) []TableSplit {
+	if tables <= 0 || tables > MaxTables || len(members) == 0 {
+		return []TableSplit{}
+	}
+
+	tallies := make(map[string]int)
+	for _, t := range votes.Tally() {
+		tallies[t.GameID] = t.Votes
+	}
+	seen := make(map[string]bool)
+	var candidates []bggclient.Game
+	for _, game := range games {
+		if seen[game.ID] || tallies[game.ID] == 0 || game.Info.MaxPlayers == 0 {
+			continue
+		}
+		seen[game.ID] = true
+		candidates = append(candidates, game)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if tallies[candidates[i].ID] != tallies[candidates[j].ID] {
+			return tallies[candidates[i].ID] > tallies[candidates[j].ID]
+		}
+		return candidates[i].ID < candidates[j].ID
+	})
+	if len(candidates) > maxTableCandidates {
+		candidates = candidates[:maxTableCandidates]
+	}
+
+	var splits []TableSplit
+	var combo []bggclient.Game
+	var search func(start int)
+	search = func(start int) {
+		if len(combo) == tables {
+			if split, ok := seatMembers(combo, votes, members); ok {
+				splits = append(splits, split)
+			}
+			return
+		}
+		for i := start; i < len(candidates); i++ {
+			combo = append(combo, candidates[i])
+			search(i + 1)
+			combo = combo[:len(combo)-1]
+		}
+	}
+	search(0)
+
+	sort.SliceStable(splits, func(i, j int) bool {
+		return splits[i].Satisfaction > splits[j].Satisfaction
+	})
+	if limit > 0 && len(splits) > limit {
+		splits = splits[:limit]
+	}
+	return splits
+}
+
+// seatMembers finds the most satisfying way of seating members at one table per game, returning false
+// if every member can't be seated within the games' player counts. Seating is solved as a min cost flow
+// from members to tables, where each table's minimum player count is made cheap enough that it is always
+// filled before any member is seated somewhere they'd be more satisfied.
+func seatMembers(games []bggclient.Game, votes storage.VoteResult, members []string) (TableSplit, bool) {
+	minTotal, maxTotal := 0, 0
+	for _, game := range games {
+		minTotal += game.Info.MinPlayers
+		maxTotal += game.Info.MaxPlayers
+	}
+	if len(members) < minTotal || len(members) > maxTotal {
+		return TableSplit{}, false
+	}
+
+	// Nodes are the source, then each member, then each table, then the sink
+	source := 0
+	memberNode := func(m int) int { return 1 + m }
+	tableNode := func(t int) int { return 1 + len(members) + t }
+	sink := 1 + len(members) + len(games)
+	f := newFlow(sink + 1)
+	fillBonus := 2 * (len(members) + 1)
+
+	satisfaction := make([][]int, len(members))
+	for m, member := range members {
+		f.addEdge(source, memberNode(m), 1, 0)
+		satisfaction[m] = make([]int, len(games))
+		for t, game := range games {
+			if contains(votes.Vetoes[member], game.ID) {
+				continue
+			}
+			if contains(votes.Votes[member], game.ID) {
+				satisfaction[m][t] = 1
+			}
+			f.addEdge(memberNode(m), tableNode(t), 1, -satisfaction[m][t])
+		}
+	}
+	for t, game := range games {
+		f.addEdge(tableNode(t), sink, game.Info.MinPlayers, -fillBonus)
+		f.addEdge(tableNode(t), sink, game.Info.MaxPlayers-game.Info.MinPlayers, 0)
+	}
+	if f.run(source, sink) != len(members) {
+		return TableSplit{}, false
+	}
+
+	split := TableSplit{
+		Tables: make([]Table, len(games)),
+	}
+	for t, game := range games {
+		split.Tables[t] = Table{
+			Game:    game,
+			Members: []string{},
+		}
+	}
+	for m, member := range members {
+		for _, e := range f.graph[memberNode(m)] {
+			// Member to table edges have a capacity of 1, so those that were used have none left
+			if e.to != source && e.cap == 0 {
+				t := e.to - tableNode(0)
+				split.Tables[t].Members = append(split.Tables[t].Members, member)
+				split.Tables[t].Satisfaction += satisfaction[m][t]
+				split.Satisfaction += satisfaction[m][t]
+			}
+		}
+	}
+	for _, table := range split.Tables {
+		if len(table.Members) < table.Game.Info.MinPlayers {
+			return TableSplit{}, false
+		}
+	}
+	return split, true
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+type flowEdge struct {
+	to, rev, cap, cost int
+}
+
+// flow is a min cost max flow solver using successive shortest paths
+type flow struct {
+	graph [][]flowEdge
+}
+
+func newFlow(nodes int) *flow {
+	return &flow{graph: make([][]flowEdge, nodes)}
+}
+
+func (f *flow) addEdge(from, to, cap, cost int) {
+	if cap <= 0 {
+		return
+	}
+	f.graph[from] = append(f.graph[from], flowEdge{to: to, rev: len(f.graph[to]), cap: cap, cost: cost})
+	f.graph[to] = append(f.graph[to], flowEdge{to: from, rev: len(f.graph[from]) - 1, cap: 0, cost: -cost})
+}
+
+// run sends as much flow as possible from source to sink at the lowest cost, returning the amount sent
+func (f *flow) run(source, sink int) int {
+	const unreachable = int(^uint(0) >> 1)
+	total := 0
+	for {
+		// Bellman-Ford is used for the shortest path, as member to table costs are negative
+		dist := make([]int, len(f.graph))
+		prevNode := make([]int, len(f.graph))
+		prevEdge := make([]int, len(f.graph))
+		for i := range dist {
+			dist[i] = unreachable
+		}
+		dist[source] = 0
+		for updated := true; updated; {
+			updated = false
+			for from, edges := range f.graph {
+				if dist[from] == unreachable {
+					continue
+				}
+				for i, e := range edges {
+					if e.cap > 0 && dist[from]+e.cost < dist[e.to] {
+						dist[e.to] = dist[from] + e.cost
+						prevNode[e.to] = from
+						prevEdge[e.to] = i
+						updated = true
+					}
+				}
+			}
+		}
+		if dist[sink] == unreachable {
+			return total
+		}
+		for node := sink; node != source; node = prevNode[node] {
+			e := &f.graph[prevNode[node]][prevEdge[node]]
+			e.cap--
+			f.graph[node][e.rev].cap++
+		}
+		total++
+	}
+}
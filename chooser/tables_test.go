@@ -0,0 +1,58 @@
+package chooser
+
+import (
+	. "testing"
+
+	"github.com/tylerdixon/bgchooser/bggclient"
+	"github.com/tylerdixon/bgchooser/storage"
+)
+
+func TestSplitTables(t *T) {
+	games := []bggclient.Game{
+		{ID: "1", Name: "Azul", Info: bggclient.GameInfo{MinPlayers: 2, MaxPlayers: 4}},
+		{ID: "2", Name: "Catan", Info: bggclient.GameInfo{MinPlayers: 3, MaxPlayers: 4}},
+		{ID: "3", Name: "Codenames", Info: bggclient.GameInfo{MinPlayers: 4, MaxPlayers: 8}},
+	}
+	votes := storage.VoteResult{
+		Votes: map[string][]string{
+			"a": {"1"},
+			"b": {"1"},
+			"c": {"2"},
+			"d": {"2"},
+			"e": {"2", "3"},
+			"f": {"3"},
+			"g": {},
+		},
+		Vetoes: map[string][]string{
+			"g": {"2"},
+		},
+	}
+	members := []string{"a", "b", "c", "d", "e", "f", "g"}
+
+	splits := SplitTables(games, votes, members, 2, 0)
+	if len(splits) == 0 {
+		t.Fatal("expected splits")
+	}
+	best := splits[0]
+	seated := 0
+	for _, table := range best.Tables {
+		seated += len(table.Members)
+		if n := len(table.Members); n < table.Game.Info.MinPlayers || n > table.Game.Info.MaxPlayers {
+			t.Errorf("expected %s to be within its player count, got %v", table.Game.Name, table.Members)
+		}
+		if table.Game.ID == "2" && contains(table.Members, "g") {
+			t.Errorf("expected g not to be seated at a game they vetoed, got %v", table.Members)
+		}
+	}
+	if seated != len(members) {
+		t.Errorf("expected every member to be seated, got %+v", best)
+	}
+	// Azul with a, b and g alongside Catan with c, d, e and f satisfies everyone but f and g
+	if best.Satisfaction != 5 {
+		t.Errorf("expected 5 members to be satisfied, got %+v", best)
+	}
+
+	if none := SplitTables(games, votes, members[:3], 2, 0); len(none) != 0 {
+		t.Errorf("expected 3 members to be too few for two tables, got %+v", none)
+	}
+}
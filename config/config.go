@@ -0,0 +1,195 @@
+// Package config loads the server's configuration from, in increasing order of precedence, its
+// defaults, a YAML config file, BGCHOOSER_* environment variables and command line flags.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// EnvPrefix is prepended to a flag's name, upper cased with dashes replaced by underscores, to give
+// the environment variable that sets it. For example, `redis-addr` is set by BGCHOOSER_REDIS_ADDR.
+const EnvPrefix = "BGCHOOSER_"
+
+type Config struct {
+	Port      int    `yaml:"port"`
+	StaticDir string `yaml:"staticDir"`
+	// RoomTTL is how long a room is kept after it was last touched
+	RoomTTL time.Duration `yaml:"roomTTL"`
+	Redis   RedisConfig   `yaml:"redis"`
+	BGG     BGGConfig     `yaml:"bgg"`
+	Server  ServerConfig  `yaml:"server"`
+}
+
+type RedisConfig struct {
+	Addr     string `yaml:"addr"`
+	Password string `yaml:"password"`
+	DB       int    `yaml:"db"`
+	TLS      bool   `yaml:"tls"`
+}
+
+type BGGConfig struct {
+	BaseURL string `yaml:"baseURL"`
+	// RequestsPerSecond limits how often BGG is requested, across every user of the server
+	RequestsPerSecond float64 `yaml:"requestsPerSecond"`
+}
+
+type ServerConfig struct {
+	ReadTimeout  time.Duration `yaml:"readTimeout"`
+	WriteTimeout time.Duration `yaml:"writeTimeout"`
+	IdleTimeout  time.Duration `yaml:"idleTimeout"`
+	// ShutdownTimeout is how long in-flight requests are given to finish when shutting down
+	ShutdownTimeout time.Duration `yaml:"shutdownTimeout"`
+}
+
+// Default returns the configuration used for anything that isn't set
+func Default() Config {
+	return Config{
+		Port:      8000,
+		StaticDir: "./build",
+		RoomTTL:   time.Hour * 24 * 14,
+		Redis: RedisConfig{
+			Addr: "localhost:6379",
+		},
+		BGG: BGGConfig{
+			BaseURL:           "https://boardgamegeek.com/xmlapi2",
+			RequestsPerSecond: 2,
+		},
+		Server: ServerConfig{
+			ReadTimeout: 15 * time.Second,
+			// Fetching a collection from BGG can take several retries, so writes are given longer
+			WriteTimeout:    60 * time.Second,
+			IdleTimeout:     120 * time.Second,
+			ShutdownTimeout: 15 * time.Second,
+		},
+	}
+}
+
+// bind registers a flag for every setting, defaulting to the setting's current value
+func bind(fs *flag.FlagSet, cfg *Config) {
+	fs.IntVar(&cfg.Port, "port", cfg.Port, "port to run service on")
+	fs.StringVar(&cfg.StaticDir, "static-dir", cfg.StaticDir, "directory the web UI is built to")
+	fs.DurationVar(&cfg.RoomTTL, "room-ttl", cfg.RoomTTL, "how long rooms are kept after they were last used")
+	fs.StringVar(&cfg.Redis.Addr, "redis-addr", cfg.Redis.Addr, "Address to access redis by")
+	fs.StringVar(&cfg.Redis.Password, "redis-password", cfg.Redis.Password, "password to access redis with")
+	fs.IntVar(&cfg.Redis.DB, "redis-db", cfg.Redis.DB, "redis database to use")
+	fs.BoolVar(&cfg.Redis.TLS, "redis-tls", cfg.Redis.TLS, "connect to redis over TLS")
+	fs.StringVar(&cfg.BGG.BaseURL, "bgg-base-url", cfg.BGG.BaseURL, "base URL of the BGG XML API")
+	fs.Float64Var(&cfg.BGG.RequestsPerSecond, "bgg-requests-per-second", cfg.BGG.RequestsPerSecond, "maximum rate of requests to BGG")
+	fs.DurationVar(&cfg.Server.ReadTimeout, "read-timeout", cfg.Server.ReadTimeout, "maximum duration for reading a request")
+	fs.DurationVar(&cfg.Server.WriteTimeout, "write-timeout", cfg.Server.WriteTimeout, "maximum duration for writing a response")
+	fs.DurationVar(&cfg.Server.IdleTimeout, "idle-timeout", cfg.Server.IdleTimeout, "maximum duration to keep idle connections open")
+	fs.DurationVar(&cfg.Server.ShutdownTimeout, "shutdown-timeout", cfg.Server.ShutdownTimeout, "how long to wait for in-flight requests when shutting down")
+}
+
+// envName returns the environment variable that sets a flag
+func envName(flagName string) string {
+	return EnvPrefix + strings.ToUpper(strings.Replace(flagName, "-", "_", -1))
+}
+
+// NewFlagSet returns the flags Load accepts, for printing usage
+func NewFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s [OPTIONS] argument ...\n", name)
+		fs.PrintDefaults()
+	}
+	cfg := Default()
+	bind(fs, &cfg)
+	fs.String("config", "", "path to a YAML config file, also set by "+EnvPrefix+"CONFIG")
+	return fs
+}
+
+// Load builds the configuration from the given command line arguments, the environment and the config
+// file they name, validating the result
+func Load(name string, args []string, getenv func(string) string) (Config, error) {
+	// Flags are parsed up front to find the config file, then applied again once it's loaded so they
+	// take precedence over it
+	fs := NewFlagSet(name)
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+	path := fs.Lookup("config").Value.String()
+	if path == "" {
+		path = getenv(EnvPrefix + "CONFIG")
+	}
+
+	cfg := Default()
+	if path != "" {
+		body, err := ioutil.ReadFile(path)
+		if err != nil {
+			return cfg, err
+		}
+		if err := yaml.UnmarshalStrict(body, &cfg); err != nil {
+			return cfg, errors.New("failed to parse config file " + path + ": " + err.Error())
+		}
+	}
+
+	settings := flag.NewFlagSet(name, flag.ContinueOnError)
+	bind(settings, &cfg)
+	var err error
+	settings.VisitAll(func(f *flag.Flag) {
+		if value, ok := lookupEnv(getenv, envName(f.Name)); ok && err == nil {
+			if setErr := settings.Set(f.Name, value); setErr != nil {
+				err = errors.New("invalid " + envName(f.Name) + ": " + setErr.Error())
+			}
+		}
+	})
+	if err != nil {
+		return cfg, err
+	}
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name != "config" && err == nil {
+			err = settings.Set(f.Name, f.Value.String())
+		}
+	})
+	if err != nil {
+		return cfg, err
+	}
+	return cfg, cfg.Validate()
+}
+
+// lookupEnv treats empty environment variables as unset, so they can't blank out a setting
+func lookupEnv(getenv func(string) string, name string) (string, bool) {
+	value := getenv(name)
+	return value, value != ""
+}
+
+// Validate checks that every setting is usable, returning the first that isn't
+func (c Config) Validate() error {
+	if c.Port < 1 || c.Port > 65535 {
+		return errors.New("port must be between 1 and 65535")
+	}
+	// The web UI may be served separately while developing, so the static dir doesn't need to exist
+	if info, err := os.Stat(c.StaticDir); err == nil && !info.IsDir() {
+		return errors.New("static dir " + c.StaticDir + " must be a directory")
+	}
+	if c.RoomTTL < time.Minute {
+		return errors.New("room TTL must be at least a minute")
+	}
+	if c.Redis.Addr == "" {
+		return errors.New("redis address is required")
+	}
+	if c.Redis.DB < 0 {
+		return errors.New("redis DB must not be negative")
+	}
+	u, err := url.Parse(c.BGG.BaseURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("BGG base URL must be an http or https URL")
+	}
+	if c.BGG.RequestsPerSecond <= 0 {
+		return errors.New("BGG requests per second must be positive")
+	}
+	if c.Server.ReadTimeout <= 0 || c.Server.WriteTimeout <= 0 || c.Server.IdleTimeout <= 0 || c.Server.ShutdownTimeout <= 0 {
+		return errors.New("server timeouts must be positive")
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	. "testing"
+	"time"
+)
+
+func env(vars map[string]string) func(string) string {
+	return func(name string) string {
+		return vars[name]
+	}
+}
+
+func TestLoadPrecedence(t *T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.yaml")
+	// JSON is valid YAML
+	err = ioutil.WriteFile(path, []byte(`{"port": 9000, "staticDir": "`+dir+`", "redis": {"addr": "redis:6379", "db": 2}}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load("bgchooser", []string{"-redis-db", "4"}, env(map[string]string{
+		"BGCHOOSER_CONFIG":     path,
+		"BGCHOOSER_REDIS_ADDR": "env-redis:6379",
+		"BGCHOOSER_REDIS_DB":   "3",
+		"BGCHOOSER_ROOM_TTL":   "48h",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Port != 9000 || cfg.StaticDir != dir {
+		t.Errorf("expected the config file to set the port and static dir, got %+v", cfg)
+	}
+	if cfg.Redis.Addr != "env-redis:6379" || cfg.RoomTTL != 48*time.Hour {
+		t.Errorf("expected the environment to override the config file, got %+v", cfg)
+	}
+	if cfg.Redis.DB != 4 {
+		t.Errorf("expected flags to override the environment, got redis DB %d", cfg.Redis.DB)
+	}
+	if cfg.BGG != Default().BGG {
+		t.Errorf("expected unset settings to keep their defaults, got %+v", cfg.BGG)
+	}
+}
+
+func TestLoadInvalid(t *T) {
+	tests := []struct {
+		args []string
+		env  map[string]string
+	}{
+		{[]string{"-port", "70000"}, nil},
+		{[]string{"-bgg-base-url", "ftp://boardgamegeek.com"}, nil},
+		{[]string{"-bgg-requests-per-second", "0"}, nil},
+		{nil, map[string]string{"BGCHOOSER_REDIS_TLS": "sometimes"}},
+		{nil, map[string]string{"BGCHOOSER_CONFIG": "/does/not/exist.yaml"}},
+	}
+	for _, test := range tests {
+		if _, err := Load("bgchooser", test.args, env(test.env)); err == nil {
+			t.Errorf("expected %v %v to be rejected", test.args, test.env)
+		}
+	}
+}
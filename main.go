@@ -1,24 +1,63 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+
+	log "github.com/Sirupsen/logrus"
 
 	"github.com/tylerdixon/bgchooser/api"
+	"github.com/tylerdixon/bgchooser/bggclient"
+	"github.com/tylerdixon/bgchooser/config"
+	"github.com/tylerdixon/bgchooser/storage"
 )
 
-var portFlag *string
-
-func init() {
-	portFlag = flag.String("port", "8000", "port to run service on")
-}
 func main() {
-	flag.Usage = func() {
-		fmt.Printf("Usage: %s [OPTIONS] argument ...\n", os.Args[0])
-		flag.PrintDefaults()
+	cfg, err := config.Load(os.Args[0], os.Args[1:], os.Getenv)
+	if err == flag.ErrHelp {
+		return
+	} else if err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid configuration: "+err.Error())
+		os.Exit(2)
+	}
+	if err := run(cfg); err != nil {
+		log.Error(log.Fields{"err": err}, "Server stopped unexpectedly")
+		os.Exit(1)
+	}
+}
+
+// run serves the api until it fails or is interrupted, shutting it down gracefully on SIGINT or SIGTERM
+func run(cfg config.Config) error {
+	bggclient.Configure(cfg.BGG)
+	stor, err := storage.New(cfg)
+	if err != nil {
+		return err
+	}
+	serv := api.New(stor, cfg)
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- serv.Start(":" + strconv.Itoa(cfg.Port))
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case err := <-errs:
+		return err
+	case sig := <-signals:
+		log.Info(log.Fields{"signal": sig.String()}, "Shutting down")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	if err := serv.Shutdown(ctx); err != nil {
+		return err
 	}
-	flag.Parse()
-	serv := api.New()
-	serv.Start(":" + *portFlag)
+	return <-errs
 }
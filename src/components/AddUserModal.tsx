@@ -1,7 +1,7 @@
 import React, { ChangeEvent } from "react";
 import { Modal, Input, Button, Message, Checkbox } from "semantic-ui-react";
 import xml2js from "xml2js";
-import { BggUserInfo, Game, GameCollection } from "../types/game";
+import { ApiError, BggUserInfo, Game, GameCollection } from "../types/game";
 import styles from "./addusermodal.module.scss";
 
 const MAX_GET_USER_ITER = 10;
@@ -165,7 +165,9 @@ class AddUserModal extends React.Component<
     fetch(`/api/rooms/${roomID}/bgguser/${encodeURIComponent(bggUser)}`)
       .then(res => {
         if (!res.ok) {
-          return res.text().then(text => Promise.reject(new Error(text)));
+          return res
+            .json()
+            .then((err: ApiError) => Promise.reject(new Error(err.message)));
         }
         return res.json();
       })
@@ -214,7 +216,9 @@ class AddUserModal extends React.Component<
     })
       .then(res => {
         if (!res.ok) {
-          return res.text().then(text => Promise.reject(new Error(text)));
+          return res
+            .json()
+            .then((err: ApiError) => Promise.reject(new Error(err.message)));
         }
         return res.json().then((res: BggUserInfo) => {
           addGames(res.games);
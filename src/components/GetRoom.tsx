@@ -30,6 +30,8 @@ class GetRoom extends Component<RouteComponentProps, any> {
     })
       .then(res => res.json())
       .then(res => {
+        // Only whoever created the room gets its host key, which is needed to manage it
+        localStorage.setItem(res.roomID + ":hostKey", res.hostKey);
         this.setState({ roomID: res.roomID });
       });
   };
@@ -24,7 +24,10 @@ import {
   VoteObj,
   RoomInfo,
   SubscriptionMessage,
-  UpdateType
+  UpdateType,
+  SocketCommand,
+  SocketCommandType,
+  SocketReply
 } from "../types/game";
 import AddUserModal from "./AddUserModal";
 import WriteInModal from "./WriteInModal";
@@ -37,6 +40,10 @@ enum Sort {
   VotesDesc
 }
 
+// How long to wait before reconnecting a dropped socket, doubling with each failed attempt
+const minReconnectDelay = 1000;
+const maxReconnectDelay = 30000;
+
 interface RoomState {
   bggUser: string;
   games: GameCollection;
@@ -57,6 +64,7 @@ interface RoomState {
   sortBy: Sort;
   showVotes: boolean;
   showGameInfo: boolean;
+  online: Array<string>;
 }
 
 interface RoomRouteParams {
@@ -80,68 +88,90 @@ class Room extends Component<RouteComponentProps<RoomRouteParams>, RoomState> {
     savingVotes: false,
     sortBy: Sort.AlphaAsc,
     showVotes: false,
-    showGameInfo: false
+    showGameInfo: false,
+    online: []
   };
 
   //TODO: Better way to handle? (don't need state)
   private _mainContainer = React.createRef<HTMLDivElement>();
 
-  socket: WebSocket = new WebSocket(
-    `${process.env.NODE_ENV === "production" ? "wss" : "ws"}://${
-      location.host
-    }/api/init`
-  );
+  // Commands sent over the socket that haven't been replied to yet, by ID
+  pendingCommands: {
+    [id: string]: {
+      onAck: (data: any) => void;
+      onError: (err: Error) => void;
+    };
+  } = {};
+  lastCommandID = 0;
+
+  socket!: WebSocket;
+  // The sequence number of the last room update seen, so missed updates can be replayed on reconnecting
+  lastSeq = 0;
+  reconnectDelay = minReconnectDelay;
+  unmounted = false;
 
   componentDidMount = () => {
     const { roomID } = this.props.match.params;
-    const { games } = this.state;
     let userID: string =
       localStorage.getItem(roomID + ":userID") ||
       Math.floor(Math.random() * 10000) + "";
     localStorage.setItem(roomID + ":userID", userID);
     this.setState({ userID });
-    fetch(`/api/rooms/${roomID}`)
-      .then(res => res.json())
-      .then((res: RoomInfo) => {
-        if (res.games) {
-          games.addGames(res.games);
-          this.setState({
-            games: games
-          });
-          if (res.voteResults.votes) {
-            Object.keys(res.voteResults.votes).forEach(key =>
-              res.voteResults.votes[key].forEach(
-                game => games.games[game] && games.games[game].addVote(key)
-              )
-            );
-            this.setState({
-              allVotes: res.voteResults.votes,
-              votes: res.voteResults.votes[userID] || []
-            });
-          }
-          if (res.voteResults.vetoes) {
-            Object.keys(res.voteResults.vetoes).forEach(key =>
-              res.voteResults.vetoes[key].forEach(
-                game => games.games[game] && games.games[game].addVeto(key)
-              )
-            );
-            this.setState({
-              allVetoes: res.voteResults.vetoes,
-              vetoes: res.voteResults.vetoes[userID] || []
-            });
-          }
-        }
-      })
-      .catch((err: Error) => {
-        this.setState({ initError: err });
-      });
+    this.connect(roomID, userID);
+  };
 
+  componentWillUnmount = () => {
+    this.unmounted = true;
+    this.socket.close();
+  };
+
+  connect = (roomID: string, userID: string) => {
+    this.socket = new WebSocket(
+      `${process.env.NODE_ENV === "production" ? "wss" : "ws"}://${
+        location.host
+      }/api/init`
+    );
     this.socket.onopen = evt => {
-      this.socket.send("register:" + roomID);
+      this.reconnectDelay = minReconnectDelay;
+      // The subscription is acked with the room's info, so it doesn't need fetching separately. After
+      // reconnecting, the updates missed in between are replayed instead, unless too many were missed.
+      this.sendCommand(
+        {
+          type: SocketCommandType.Subscribe,
+          roomID,
+          user: userID,
+          token: localStorage.getItem(roomID + ":voterToken") || undefined,
+          lastSeq: this.lastSeq || undefined
+        },
+        (res?: RoomInfo) => {
+          if (res) {
+            // A snapshot after reconnecting replaces the votes seen before
+            if (this.lastSeq) {
+              this.state.games.resetVotes();
+            }
+            this.lastSeq = res.seq;
+            this.loadRoomInfo(res, userID);
+          }
+          this.setState({ initError: undefined });
+        },
+        err => this.setState({ initError: err })
+      );
     };
     this.socket.onmessage = evt => {
       console.log(evt.data);
-      const data: SubscriptionMessage = JSON.parse(evt.data);
+      const msg: SubscriptionMessage | SocketReply = JSON.parse(evt.data);
+      if (msg.type === "ack" || msg.type === "error") {
+        this.handleReply(msg as SocketReply);
+        return;
+      }
+      const data = msg as SubscriptionMessage;
+      if (data.seq) {
+        // Updates sent while being replayed may also arrive live
+        if (data.seq <= this.lastSeq) {
+          return;
+        }
+        this.lastSeq = data.seq;
+      }
       if (data.type === UpdateType.UpdateTypeAddedVotes) {
         this.state.games
           .toArray()
@@ -151,20 +181,96 @@ class Room extends Component<RouteComponentProps<RoomRouteParams>, RoomState> {
       } else if (data.type === UpdateType.UpdateTypeResetVotes) {
         this.state.games.resetVotes();
         this.setState({ votes: [], vetoes: [] });
+      } else if (data.type === UpdateType.UpdateTypeJoined) {
+        const online = this.state.online.filter(user => user !== data.user);
+        this.setState({ online: [...online, data.user].sort() });
+      } else if (data.type === UpdateType.UpdateTypeLeft) {
+        this.setState({
+          online: this.state.online.filter(user => user !== data.user)
+        });
       }
 
       this.setState({ games: this.state.games });
       this.forceUpdate();
     };
-    this.socket.onerror = evt => {
+    this.socket.onclose = evt => {
+      // Commands awaiting replies won't get them over a new connection
+      Object.keys(this.pendingCommands).forEach(id =>
+        this.pendingCommands[id].onError(new Error("Connection lost"))
+      );
+      this.pendingCommands = {};
+      if (this.unmounted) {
+        return;
+      }
       this.setState({
-        initError: new Error(
-          "Error connecting to service. Refresh page to try again."
-        )
+        initError: new Error("Connection lost. Reconnecting...")
       });
+      setTimeout(() => this.connect(roomID, userID), this.reconnectDelay);
+      this.reconnectDelay = Math.min(
+        this.reconnectDelay * 2,
+        maxReconnectDelay
+      );
     };
   };
 
+  loadRoomInfo = (res: RoomInfo, userID: string) => {
+    const { games } = this.state;
+    this.setState({ online: res.online || [] });
+    if (res.games) {
+      games.addGames(res.games);
+      this.setState({
+        games: games
+      });
+      if (res.voteResults.votes) {
+        Object.keys(res.voteResults.votes).forEach(key =>
+          res.voteResults.votes[key].forEach(
+            game => games.games[game] && games.games[game].addVote(key)
+          )
+        );
+        this.setState({
+          allVotes: res.voteResults.votes,
+          votes: res.voteResults.votes[userID] || []
+        });
+      }
+      if (res.voteResults.vetoes) {
+        Object.keys(res.voteResults.vetoes).forEach(key =>
+          res.voteResults.vetoes[key].forEach(
+            game => games.games[game] && games.games[game].addVeto(key)
+          )
+        );
+        this.setState({
+          allVetoes: res.voteResults.vetoes,
+          vetoes: res.voteResults.vetoes[userID] || []
+        });
+      }
+    }
+  };
+
+  sendCommand = (
+    command: Pick<SocketCommand, Exclude<keyof SocketCommand, "id">>,
+    onAck: (data: any) => void,
+    onError: (err: Error) => void
+  ) => {
+    const id = String(++this.lastCommandID);
+    this.pendingCommands[id] = { onAck, onError };
+    this.socket.send(JSON.stringify({ ...command, id }));
+  };
+
+  handleReply = (reply: SocketReply) => {
+    const pending = reply.id && this.pendingCommands[reply.id];
+    if (!pending) {
+      return;
+    }
+    delete this.pendingCommands[reply.id as string];
+    if (reply.type === "error") {
+      pending.onError(
+        new Error(reply.error ? reply.error.message : "Command failed")
+      );
+    } else {
+      pending.onAck(reply.data);
+    }
+  };
+
   toggleBggUserModal = () => {
     this.setState({ bggUserModalOpen: !this.state.bggUserModalOpen });
   };
@@ -213,24 +319,31 @@ class Room extends Component<RouteComponentProps<RoomRouteParams>, RoomState> {
       }
     }
     this.setState({ savingVotes: true, votes: newVotes, vetoes: newVetoes });
-    fetch(`/api/rooms/${roomID}/vote/${userID}`, {
-      method: "POST",
-      body: JSON.stringify({
+    this.sendCommand(
+      {
+        type: SocketCommandType.Vote,
+        roomID,
+        user: userID,
+        token: localStorage.getItem(roomID + ":voterToken") || undefined,
         votes: newVotes,
         vetoes: newVetoes
-      })
-    })
-      .then(() => this.setState({ savingVotes: false }))
-      .catch((err: Error) => {
-        this.setState({ votesError: err, savingVotes: false });
-      });
+      },
+      (res: { token: string }) => {
+        localStorage.setItem(roomID + ":voterToken", res.token);
+        this.setState({ savingVotes: false });
+      },
+      err => this.setState({ votesError: err, savingVotes: false })
+    );
   };
 
   resetVotes = () => {
     const { roomID } = this.props.match.params;
     this.setState({ savingVotes: true });
     fetch(`/api/rooms/${roomID}/vote/reset`, {
-      method: "POST"
+      method: "POST",
+      body: JSON.stringify({
+        hostKey: localStorage.getItem(roomID + ":hostKey") || ""
+      })
     })
       .then(() => this.setState({ savingVotes: false }))
       .catch((err: Error) => {
@@ -262,7 +375,8 @@ class Room extends Component<RouteComponentProps<RoomRouteParams>, RoomState> {
       showVotes,
       writeInModalOpen,
       showGameInfo,
-      userID
+      userID,
+      online
     } = this.state;
     return (
       <Container className={styles.roomInfoContainer}>
@@ -283,6 +397,7 @@ class Room extends Component<RouteComponentProps<RoomRouteParams>, RoomState> {
             />
           </Dropdown.Menu>
         </Dropdown>
+        {online.length > 0 && <p>Online: {online.join(", ")}</p>}
         {initError && (
           <Message negative>
             <Message.Header>
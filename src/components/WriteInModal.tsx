@@ -9,7 +9,7 @@ import {
   SearchProps
 } from "semantic-ui-react";
 import xml2js from "xml2js";
-import { Game, GameCollection, AddGameRes } from "../types/game";
+import { Game, GameCollection, AddGameRes, ApiError } from "../types/game";
 import styles from "./writeinmodal.module.scss";
 
 interface SearchGame {
@@ -129,7 +129,9 @@ class WriteInModal extends React.Component<
     })
       .then(res => {
         if (!res.ok) {
-          return res.text().then(text => Promise.reject(new Error(text)));
+          return res
+            .json()
+            .then((err: ApiError) => Promise.reject(new Error(err.message)));
         }
         return res.json().then((res: AddGameRes) => {
           addGames([res.game]);
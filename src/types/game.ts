@@ -108,12 +108,61 @@ export interface SubscriptionMessage {
   votes: Array<string>;
   vetoes: Array<string>;
   user: string;
+  state?: RoomState;
+  progress?: VoteProgress;
+  winner?: string;
+  round?: number;
+  candidates?: Array<string>;
+  tables?: TableSplit;
+  pick?: PickResult;
+  roomID?: string;
+  seq?: number;
+}
+
+export interface PickResult {
+  gameID: string;
+  seed: string;
+  commitment: string;
+  candidates: Array<{ gameID: string; weight: number }>;
+  roll: number;
+  nextCommitment: string;
+}
+
+export interface Table {
+  game: Game;
+  members: Array<string>;
+  satisfaction: number;
+}
+
+export interface TableSplit {
+  tables: Array<Table>;
+  satisfaction: number;
 }
 
 export enum UpdateType {
   UpdateTypeAddedGames = "addedGamesUpdate",
   UpdateTypeAddedVotes = "addedVotesUpdate",
-  UpdateTypeResetVotes = "resetVotesUpdate"
+  UpdateTypeResetVotes = "resetVotesUpdate",
+  UpdateTypeStateChanged = "stateChangedUpdate",
+  UpdateTypeVoteProgress = "voteProgressUpdate",
+  UpdateTypeRoundClosed = "roundClosedUpdate",
+  UpdateTypeNewRound = "newRoundUpdate",
+  UpdateTypeTables = "tablesUpdate",
+  UpdateTypePicked = "pickedUpdate",
+  UpdateTypeJoined = "joinedUpdate",
+  UpdateTypeLeft = "leftUpdate"
+}
+
+export enum RoomState {
+  Collecting = "collecting",
+  Voting = "voting",
+  Revealed = "revealed",
+  Finished = "finished"
+}
+
+export interface VoteProgress {
+  voted: number;
+  members: number;
 }
 
 export interface GameInfo {
@@ -121,6 +170,7 @@ export interface GameInfo {
   maxPlayers: number;
   minPlaytime: number;
   maxPlaytime: number;
+  averageRating?: number;
 }
 
 export interface BggUserInfo {
@@ -131,6 +181,42 @@ export interface AddGameRes {
   game: Game;
 }
 
+export interface ApiError {
+  code: string;
+  message: string;
+  retryAfter?: number;
+}
+
+export enum SocketCommandType {
+  Subscribe = "subscribe",
+  Unsubscribe = "unsubscribe",
+  Vote = "vote",
+  AddGames = "addGames",
+  Snapshot = "snapshot"
+}
+
+export interface SocketCommand {
+  id: string;
+  type: SocketCommandType;
+  roomID: string;
+  user?: string;
+  // The token issued to the user on their first vote, which is needed to vote again or see their votes
+  token?: string;
+  votes?: Array<string>;
+  vetoes?: Array<string>;
+  games?: Array<Game>;
+  gameIDs?: Array<string>;
+  lastSeq?: number;
+  query?: { [key: string]: string };
+}
+
+export interface SocketReply {
+  type: "ack" | "error";
+  id?: string;
+  data?: any;
+  error?: ApiError;
+}
+
 export interface AddGamesMessage {
   progress: number;
   game: Game;
@@ -141,6 +227,13 @@ export interface AddGamesMessage {
 export interface RoomInfo {
   games: Array<Game>;
   voteResults: VoteResults;
+  state: RoomState;
+  voteProgress: VoteProgress;
+  deadline?: string;
+  round: number;
+  candidates?: Array<string>;
+  online: Array<string>;
+  seq: number;
 }
 
 export interface VoteObj {
@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/tylerdixon/bgchooser/bggclient"
+)
+
+// gameDetailsTTL is how long a game's community statistics are cached, as they change slowly
+const gameDetailsTTL = time.Hour * 24 * 7
+
+// SetGameDetails caches the community statistics for a set of games
+func (s *Storage) SetGameDetails(ctx context.Context, details map[string]bggclient.GameDetails) error {
+	for gameID, d := range details {
+		detailsToStore, err := json.Marshal(d)
+		if err != nil {
+			return err
+		}
+		cmd := s.redisClient.WithContext(ctx).Set("details:"+gameID, detailsToStore, gameDetailsTTL)
+		err = cmd.Err()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetGameDetails retrieves the cached community statistics for a set of games. Games that aren't cached are left out.
+func (s *Storage) GetGameDetails(ctx context.Context, gameIDs []string) (map[string]bggclient.GameDetails, error) {
+	details := make(map[string]bggclient.GameDetails)
+	for _, gameID := range gameIDs {
+		cmd := s.redisClient.WithContext(ctx).Get("details:" + gameID)
+		res, err := cmd.Result()
+		if err == redis.Nil {
+			continue
+		} else if err != nil {
+			return details, err
+		}
+		var d bggclient.GameDetails
+		err = json.Unmarshal([]byte(res), &d)
+		if err != nil {
+			return details, err
+		}
+		details[gameID] = d
+	}
+	return details, nil
+}
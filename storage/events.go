@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/go-redis/redis"
+)
+
+// eventLogLength is roughly how many of a room's latest updates are kept for clients to catch up on
+const eventLogLength = 500
+
+var errMalformedMessage = errors.New("malformed room update")
+
+// publishScript numbers a room update, appends it to the room's event log and publishes it. Running it
+// as a script means updates are published in the same order as their sequence numbers.
+var publishScript = redis.NewScript(`
+local seq = redis.call('INCR', KEYS[1])
+redis.call('XADD', KEYS[2], 'MAXLEN', '~', ARGV[3], seq .. '-0', 'payload', ARGV[2])
+if tonumber(ARGV[4]) > 0 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[4])
+	redis.call('PEXPIRE', KEYS[2], ARGV[4])
+end
+redis.call('PUBLISH', ARGV[1], seq .. '::' .. ARGV[2])
+return seq
+`)
+
+// publish sends an update to a room's subscribers, recording it in the room's event log
+func (s *Storage) publish(ctx context.Context, roomID, payload string) error {
+	keys := []string{"seq:" + roomID, "events:" + roomID}
+	return publishScript.Run(s.redisClient.WithContext(ctx), keys,
+		"room:"+roomID, payload, eventLogLength, int64(s.roomTTL/time.Millisecond)).Err()
+}
+
+// parseRoomEvent parses an update as it's published, prefixed with its sequence number
+func parseRoomEvent(payload string) (int64, RoomSubscriptionMessage, error) {
+	parts := strings.SplitN(payload, "::", 2)
+	if len(parts) != 2 {
+		return 0, RoomSubscriptionMessage{}, errMalformedMessage
+	}
+	seq, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return 0, RoomSubscriptionMessage{}, errMalformedMessage
+	}
+	msg, err := parseRoomMessage(parts[1])
+	return seq, msg, err
+}
+
+// GetRoomSeq retrieves the sequence number of the latest update published to a room, or 0 if there
+// hasn't been one
+func (s *Storage) GetRoomSeq(ctx context.Context, roomID string) (int64, error) {
+	seq, err := s.redisClient.WithContext(ctx).Get("seq:" + roomID).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return seq, err
+}
+
+// GetRoomEventsSince retrieves the updates published to a room after the given sequence number. It
+// returns false if the event log no longer holds all of them, in which case the room's current info
+// needs fetching instead. Updates in the log that can't be parsed are skipped, so one bad update
+// doesn't keep clients from catching up on the rest.
+func (s *Storage) GetRoomEventsSince(ctx context.Context, roomID string, since int64) ([]RoomSubscriptionMessage, bool, error) {
+	latest, err := s.GetRoomSeq(ctx, roomID)
+	if err != nil {
+		return nil, false, err
+	}
+	if since == latest {
+		return nil, true, nil
+	}
+	// A sequence number ahead of the room's means the room expired and was recreated since
+	if since > latest {
+		return nil, false, nil
+	}
+
+	entries, err := s.redisClient.WithContext(ctx).XRange("events:"+roomID, strconv.FormatInt(since+1, 10)+"-0", "+").Result()
+	if err != nil {
+		return nil, false, err
+	}
+	var msgs []RoomSubscriptionMessage
+	for i, entry := range entries {
+		seq, err := strconv.ParseInt(strings.SplitN(entry.ID, "-", 2)[0], 10, 64)
+		if err != nil {
+			return nil, false, errMalformedMessage
+		}
+		if i == 0 && seq != since+1 {
+			// The first missed update has already been trimmed from the log
+			return nil, false, nil
+		}
+		payload, _ := entry.Values["payload"].(string)
+		msg, err := parseRoomMessage(payload)
+		if err != nil {
+			log.Warn(log.Fields{"roomID": roomID, "seq": seq, "payload": payload, "err": err}, "Skipping malformed room update")
+			continue
+		}
+		msg.Seq = seq
+		msgs = append(msgs, msg)
+	}
+	return msgs, len(entries) > 0, nil
+}
@@ -0,0 +1,62 @@
+package storage
+
+import (
+	. "testing"
+)
+
+func TestParseRoomEvent(t *T) {
+	seq, msg, err := parseRoomEvent("12::" + UpdateTypeAddedVotes + "::alice::1;;2::3")
+	if err != nil {
+		t.Fatalf("expected event to parse, got %v", err)
+	}
+	if seq != 12 {
+		t.Errorf("expected sequence number 12, got %d", seq)
+	}
+	if msg.Type != UpdateTypeAddedVotes || msg.User != "alice" {
+		t.Errorf("expected votes from alice, got %+v", msg)
+	}
+	if len(msg.Votes) != 2 || msg.Votes[1] != "2" || len(msg.Vetoes) != 1 || msg.Vetoes[0] != "3" {
+		t.Errorf("expected votes [1 2] and vetoes [3], got %v and %v", msg.Votes, msg.Vetoes)
+	}
+
+	// Tables are JSON that may contain the separator
+	_, msg, err = parseRoomEvent(`3::` + UpdateTypeTables + `::{"note":"a::b"}`)
+	if err != nil {
+		t.Fatalf("expected tables event to parse, got %v", err)
+	}
+	if string(msg.Tables) != `{"note":"a::b"}` {
+		t.Errorf("expected tables to be kept whole, got %s", msg.Tables)
+	}
+
+	// Custom game names are chosen by users
+	_, msg, err = parseRoomEvent(`4::` + string(UpdateTypeAddedGames) + `::alice::[{"id":"custom-x","name":"Proto::Type"}]`)
+	if err != nil {
+		t.Fatalf("expected games event to parse, got %v", err)
+	}
+	if msg.User != "alice" || len(msg.Games) != 1 || msg.Games[0].Name != "Proto::Type" {
+		t.Errorf("expected alice's game Proto::Type, got %+v", msg)
+	}
+
+	// So are user names
+	_, msg, err = parseRoomEvent("5::" + UpdateTypeAddedVotes + "::al::ice::1;;2::3")
+	if err != nil || msg.User != "al::ice" || len(msg.Votes) != 2 || len(msg.Vetoes) != 1 {
+		t.Errorf("expected votes from al::ice, got %+v, %v", msg, err)
+	}
+	_, msg, err = parseRoomEvent("6::" + UpdateTypeLeft + "::al::ice")
+	if err != nil || msg.User != "al::ice" {
+		t.Errorf("expected al::ice to leave, got %+v, %v", msg, err)
+	}
+}
+
+func TestParseRoomEventMalformed(t *T) {
+	for _, payload := range []string{
+		UpdateTypeResetVotes,
+		"x::" + UpdateTypeResetVotes,
+		"4::" + UpdateTypeStateChanged,
+		"5::unknownUpdate",
+	} {
+		if _, _, err := parseRoomEvent(payload); err != errMalformedMessage {
+			t.Errorf("expected %q to be malformed, got %v", payload, err)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/go-redis/redis"
+	"github.com/tylerdixon/bgchooser/bggclient"
+)
+
+var (
+	ErrGroupNotFound    = errors.New("group not found")
+	ErrGroupEditClashed = errors.New("the group kept changing while it was being edited")
+)
+
+// groupEditRetries is how many times an edit to a group is retried when someone else edits it at the same time
+const groupEditRetries = 5
+
+// GroupMember represents a regular member of a group, along with the BGG user their collection belongs to
+type GroupMember struct {
+	Name    string `json:"name"`
+	BggUser string `json:"bggUser,omitempty"`
+}
+
+// Group represents a set of people who meet for game nights across many rooms
+type Group struct {
+	ID      string        `json:"id"`
+	Name    string        `json:"name"`
+	Members []GroupMember `json:"members"`
+}
+
+// SaveGroup stores a group. Groups outlive the rooms created from them, so they are never expired.
+func (s *Storage) SaveGroup(ctx context.Context, group Group) error {
+	groupToStore, err := json.Marshal(group)
+	if err != nil {
+		return err
+	}
+	cmd := s.redisClient.WithContext(ctx).Set("group:"+group.ID, groupToStore, 0)
+	return cmd.Err()
+}
+
+// GetGroup retrieves a group by its ID
+func (s *Storage) GetGroup(ctx context.Context, groupID string) (Group, error) {
+	cmd := s.redisClient.WithContext(ctx).Get("group:" + groupID)
+	res, err := cmd.Result()
+	if err == redis.Nil {
+		return Group{}, ErrGroupNotFound
+	} else if err != nil {
+		return Group{}, err
+	}
+	var group Group
+	err = json.Unmarshal([]byte(res), &group)
+	return group, err
+}
+
+// UpdateGroup applies an edit to a group, retrying it if the group is changed by someone else before
+// the edit is saved. An error returned by edit is returned without the group being saved.
+func (s *Storage) UpdateGroup(ctx context.Context, groupID string, edit func(*Group) error) error {
+	key := "group:" + groupID
+	update := func(tx *redis.Tx) error {
+		res, err := tx.Get(key).Result()
+		if err == redis.Nil {
+			return ErrGroupNotFound
+		} else if err != nil {
+			return err
+		}
+		var group Group
+		err = json.Unmarshal([]byte(res), &group)
+		if err != nil {
+			return err
+		}
+		err = edit(&group)
+		if err != nil {
+			return err
+		}
+		groupToStore, err := json.Marshal(group)
+		if err != nil {
+			return err
+		}
+		// Only saved if the group hasn't changed since it was read
+		_, err = tx.Pipelined(func(pipe redis.Pipeliner) error {
+			pipe.Set(key, groupToStore, 0)
+			return nil
+		})
+		return err
+	}
+	for i := 0; i < groupEditRetries; i++ {
+		err := s.redisClient.WithContext(ctx).Watch(update, key)
+		if err != redis.TxFailedErr {
+			return err
+		}
+	}
+	return ErrGroupEditClashed
+}
+
+// SetGroupLibrary caches the collection of one of a group's BGG users
+func (s *Storage) SetGroupLibrary(ctx context.Context, groupID, bggUser string, games []bggclient.Game) error {
+	gamesToStore, err := json.Marshal(games)
+	if err != nil {
+		return err
+	}
+	cmd := s.redisClient.WithContext(ctx).HSet("library:"+groupID, bggUser, gamesToStore)
+	return cmd.Err()
+}
+
+// RemoveGroupLibrary removes the cached collection of a BGG user who is no longer in a group
+func (s *Storage) RemoveGroupLibrary(ctx context.Context, groupID, bggUser string) error {
+	cmd := s.redisClient.WithContext(ctx).HDel("library:"+groupID, bggUser)
+	return cmd.Err()
+}
+
+// GetGroupLibrary retrieves the cached collections of a group, keyed by BGG user
+func (s *Storage) GetGroupLibrary(ctx context.Context, groupID string) (map[string][]bggclient.Game, error) {
+	cmd := s.redisClient.WithContext(ctx).HGetAll("library:" + groupID)
+	res, err := cmd.Result()
+	if err != nil {
+		return map[string][]bggclient.Game{}, err
+	}
+	library := make(map[string][]bggclient.Game)
+	for bggUser, gamesList := range res {
+		var games []bggclient.Game
+		err := json.Unmarshal([]byte(gamesList), &games)
+		if err != nil {
+			return library, err
+		}
+		library[bggUser] = games
+	}
+	return library, nil
+}
+
+// AddRoomMembers adds members to a room before they have added games or voted
+func (s *Storage) AddRoomMembers(ctx context.Context, roomID string, members []GroupMember) error {
+	if len(members) == 0 {
+		return nil
+	}
+	toAdd := make(map[string]interface{})
+	for _, member := range members {
+		toAdd[member.Name] = member.BggUser
+	}
+	cmd := s.redisClient.WithContext(ctx).HMSet("members:"+roomID, toAdd)
+	err := cmd.Err()
+	if err != nil {
+		return err
+	}
+	go s.SetExpire(roomID)
+	return nil
+}
+
+// GetRoomMembers retrieves the members that were added to a room from its group
+func (s *Storage) GetRoomMembers(ctx context.Context, roomID string) ([]GroupMember, error) {
+	cmd := s.redisClient.WithContext(ctx).HGetAll("members:" + roomID)
+	res, err := cmd.Result()
+	if err != nil {
+		return []GroupMember{}, err
+	}
+	members := make([]GroupMember, 0, len(res))
+	for name, bggUser := range res {
+		members = append(members, GroupMember{
+			Name:    name,
+			BggUser: bggUser,
+		})
+	}
+	return members, nil
+}
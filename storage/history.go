@@ -0,0 +1,228 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+var (
+	ErrRoomNotFinished = errors.New("room has not finished choosing a game")
+	ErrGameNotInRoom   = errors.New("the game chosen must be one of the room's games")
+)
+
+// finishRetries is how many times finishing a room is tried when its meta changes while it's finished
+const finishRetries = 5
+
+// Session represents a finished game night, recorded in its group's history once a game is chosen
+type Session struct {
+	RoomID    string            `json:"roomID"`
+	Date      time.Time         `json:"date"`
+	Attendees []string          `json:"attendees"`
+	Winner    string            `json:"winner"`
+	Tally     []GameTally       `json:"tally"`
+	GameNames map[string]string `json:"gameNames"`
+}
+
+// GameStat represents how often a group has played and vetoed a game
+type GameStat struct {
+	GameID              string    `json:"gameID"`
+	Name                string    `json:"name"`
+	Plays               int       `json:"plays"`
+	Vetoes              int       `json:"vetoes"`
+	LastPlayed          time.Time `json:"lastPlayed"`
+	DaysSinceLastPlayed int       `json:"daysSinceLastPlayed"`
+}
+
+// HistoryStats summarizes a group's sessions
+type HistoryStats struct {
+	MostPlayed []GameStat `json:"mostPlayed"`
+	MostVetoed []GameStat `json:"mostVetoed"`
+}
+
+// FinishRoom marks a room as finished with the given game, or the winner of its votes if no game is
+// given. If the room belongs to a group, the session is recorded in the group's history. The room is
+// moved to finished in a transaction that checks it's still revealed, so a session is only recorded
+// by whoever actually finishes the room.
+func (s *Storage) FinishRoom(ctx context.Context, roomID, gameID string) (Session, error) {
+	meta, err := s.GetRoomMeta(ctx, roomID)
+	if err != nil {
+		return Session{}, err
+	}
+	if nextRoomState[meta.State] != RoomStateFinished {
+		return Session{}, ErrInvalidTransition
+	}
+
+	votes, err := s.GetUserVotes(ctx, roomID)
+	if err != nil {
+		return Session{}, err
+	}
+	games, err := s.GetGamesForRoom(ctx, roomID)
+	if err != nil {
+		return Session{}, err
+	}
+	attendees, err := s.roomMembers(ctx, roomID)
+	if err != nil {
+		return Session{}, err
+	}
+
+	session := Session{
+		RoomID:    roomID,
+		Date:      time.Now(),
+		Attendees: attendees,
+		Winner:    gameID,
+		Tally:     votes.Tally(),
+		GameNames: make(map[string]string),
+	}
+	if session.Winner == "" {
+		session.Winner = votes.Winner()
+	}
+	for _, game := range games {
+		session.GameNames[game.ID] = game.Name
+	}
+	if _, ok := session.GameNames[gameID]; gameID != "" && !ok {
+		return Session{}, ErrGameNotInRoom
+	}
+
+	sessionToStore, err := json.Marshal(session)
+	if err != nil {
+		return session, err
+	}
+	key := "meta:" + roomID
+	finish := func(tx *redis.Tx) error {
+		state, err := tx.HGet(key, "state").Result()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+		if nextRoomState[RoomState(state)] != RoomStateFinished {
+			return ErrInvalidTransition
+		}
+		_, err = tx.Pipelined(func(pipe redis.Pipeliner) error {
+			pipe.HSet(key, "session", sessionToStore)
+			pipe.HSet(key, "state", string(RoomStateFinished))
+			return nil
+		})
+		return err
+	}
+	err = redis.TxFailedErr
+	for i := 0; i < finishRetries && err == redis.TxFailedErr; i++ {
+		err = s.redisClient.WithContext(ctx).Watch(finish, key)
+	}
+	if err != nil {
+		return session, err
+	}
+	go s.SetExpire(roomID)
+
+	if session.Winner != "" {
+		err = s.RecordChosenGame(ctx, roomID, session.Winner)
+		if err != nil {
+			return session, err
+		}
+	}
+	if meta.GroupID != "" {
+		err = s.recordSession(ctx, meta.GroupID, session)
+		if err != nil {
+			return session, err
+		}
+	}
+	return session, s.announceState(ctx, roomID, RoomStateFinished)
+}
+
+func (s *Storage) recordSession(ctx context.Context, groupID string, session Session) error {
+	sessionToStore, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	// History outlives the rooms it came from, so it is never expired
+	cmd := s.redisClient.WithContext(ctx).LPush("history:"+groupID, sessionToStore)
+	return cmd.Err()
+}
+
+// GetRoomSession retrieves the session recorded when a room finished
+func (s *Storage) GetRoomSession(ctx context.Context, roomID string) (Session, error) {
+	cmd := s.redisClient.WithContext(ctx).HGet("meta:"+roomID, "session")
+	res, err := cmd.Result()
+	if err == redis.Nil {
+		return Session{}, ErrRoomNotFinished
+	} else if err != nil {
+		return Session{}, err
+	}
+	var session Session
+	err = json.Unmarshal([]byte(res), &session)
+	return session, err
+}
+
+// GetGroupHistory retrieves every session recorded for a group, most recent first
+func (s *Storage) GetGroupHistory(ctx context.Context, groupID string) ([]Session, error) {
+	cmd := s.redisClient.WithContext(ctx).LRange("history:"+groupID, 0, -1)
+	res, err := cmd.Result()
+	if err != nil {
+		return []Session{}, err
+	}
+	sessions := make([]Session, 0, len(res))
+	for _, sess := range res {
+		var session Session
+		err := json.Unmarshal([]byte(sess), &session)
+		if err != nil {
+			return sessions, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, nil
+}
+
+// GetHistoryStats summarizes which games have been played and vetoed most across sessions
+func GetHistoryStats(sessions []Session, now time.Time) HistoryStats {
+	stats := make(map[string]*GameStat)
+	get := func(gameID string, names map[string]string) *GameStat {
+		if _, ok := stats[gameID]; !ok {
+			stats[gameID] = &GameStat{GameID: gameID}
+		}
+		if stats[gameID].Name == "" {
+			stats[gameID].Name = names[gameID]
+		}
+		return stats[gameID]
+	}
+	for _, session := range sessions {
+		if session.Winner != "" {
+			stat := get(session.Winner, session.GameNames)
+			stat.Plays++
+			if session.Date.After(stat.LastPlayed) {
+				stat.LastPlayed = session.Date
+				stat.DaysSinceLastPlayed = int(now.Sub(session.Date).Hours() / 24)
+			}
+		}
+		for _, tally := range session.Tally {
+			if tally.Vetoes > 0 {
+				get(tally.GameID, session.GameNames).Vetoes += tally.Vetoes
+			}
+		}
+	}
+
+	var res HistoryStats
+	for _, stat := range stats {
+		if stat.Plays > 0 {
+			res.MostPlayed = append(res.MostPlayed, *stat)
+		}
+		if stat.Vetoes > 0 {
+			res.MostVetoed = append(res.MostVetoed, *stat)
+		}
+	}
+	sort.Slice(res.MostPlayed, func(i, j int) bool {
+		if res.MostPlayed[i].Plays != res.MostPlayed[j].Plays {
+			return res.MostPlayed[i].Plays > res.MostPlayed[j].Plays
+		}
+		return res.MostPlayed[i].GameID < res.MostPlayed[j].GameID
+	})
+	sort.Slice(res.MostVetoed, func(i, j int) bool {
+		if res.MostVetoed[i].Vetoes != res.MostVetoed[j].Vetoes {
+			return res.MostVetoed[i].Vetoes > res.MostVetoed[j].Vetoes
+		}
+		return res.MostVetoed[i].GameID < res.MostVetoed[j].GameID
+	})
+	return res
+}
@@ -0,0 +1,43 @@
+package storage
+
+import (
+	. "testing"
+	"time"
+)
+
+func TestGetHistoryStats(t *T) {
+	now := time.Date(2020, 3, 10, 20, 0, 0, 0, time.UTC)
+	sessions := []Session{
+		{
+			Date:      now.Add(-24 * time.Hour),
+			Winner:    "1",
+			Tally:     []GameTally{{GameID: "1", Votes: 2}, {GameID: "2", Votes: 1, Vetoes: 1}},
+			GameNames: map[string]string{"1": "Azul", "2": "Catan"},
+		},
+		{
+			Date:      now.Add(-10 * 24 * time.Hour),
+			Winner:    "1",
+			Tally:     []GameTally{{GameID: "1", Votes: 1}, {GameID: "2", Vetoes: 2}},
+			GameNames: map[string]string{"1": "Azul", "2": "Catan"},
+		},
+		{
+			Date:      now.Add(-20 * 24 * time.Hour),
+			Winner:    "3",
+			GameNames: map[string]string{"3": "Root"},
+		},
+	}
+
+	stats := GetHistoryStats(sessions, now)
+	if len(stats.MostPlayed) != 2 {
+		t.Fatalf("expected 2 played games, got %+v", stats.MostPlayed)
+	}
+	if stats.MostPlayed[0].GameID != "1" || stats.MostPlayed[0].Plays != 2 || stats.MostPlayed[0].DaysSinceLastPlayed != 1 {
+		t.Errorf("expected Azul to be played twice, last played a day ago, got %+v", stats.MostPlayed[0])
+	}
+	if stats.MostPlayed[1].Name != "Root" || stats.MostPlayed[1].DaysSinceLastPlayed != 20 {
+		t.Errorf("expected Root to be last played 20 days ago, got %+v", stats.MostPlayed[1])
+	}
+	if len(stats.MostVetoed) != 1 || stats.MostVetoed[0].Name != "Catan" || stats.MostVetoed[0].Vetoes != 3 {
+		t.Errorf("expected Catan to be vetoed 3 times, got %+v", stats.MostVetoed)
+	}
+}
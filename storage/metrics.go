@@ -0,0 +1,16 @@
+package storage
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var activeSubscriptions = prometheus.NewGauge(prometheus.GaugeOpts{
+	Namespace: "bgchooser",
+	Subsystem: "redis",
+	Name:      "room_subscriptions",
+	Help:      "Room pub/sub subscriptions currently open.",
+})
+
+func init() {
+	prometheus.MustRegister(activeSubscriptions)
+}
@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/go-redis/redis"
+)
+
+var ErrNoPickSeed = errors.New("no seed has been committed for the room's next pick")
+
+// EnsurePickSeed stores the given seed for a room's next random pick, unless it already has one,
+// returning whichever seed is now committed
+func (s *Storage) EnsurePickSeed(ctx context.Context, roomID, seed string) (string, error) {
+	setCmd := s.redisClient.WithContext(ctx).HSetNX("meta:"+roomID, "pickSeed", seed)
+	err := setCmd.Err()
+	if err != nil {
+		return "", err
+	}
+	go s.SetExpire(roomID)
+	cmd := s.redisClient.WithContext(ctx).HGet("meta:"+roomID, "pickSeed")
+	return cmd.Result()
+}
+
+// TakePickSeed retrieves and removes a room's committed seed, so that it can only be used for a single pick
+func (s *Storage) TakePickSeed(ctx context.Context, roomID string) (string, error) {
+	cmd := s.redisClient.WithContext(ctx).HGet("meta:"+roomID, "pickSeed")
+	seed, err := cmd.Result()
+	if err == redis.Nil {
+		return "", ErrNoPickSeed
+	} else if err != nil {
+		return "", err
+	}
+	delCmd := s.redisClient.WithContext(ctx).HDel("meta:"+roomID, "pickSeed")
+	deleted, err := delCmd.Result()
+	if err != nil {
+		return "", err
+	}
+	// Someone else took the seed between reading and removing it
+	if deleted == 0 {
+		return "", ErrNoPickSeed
+	}
+	return seed, nil
+}
+
+// SavePick stores a room's random pick for its current round, unless one was already stored. It returns
+// whichever pick is stored for the round, along with whether it's the one given.
+func (s *Storage) SavePick(ctx context.Context, roomID string, pick json.RawMessage) (json.RawMessage, bool, error) {
+	setCmd := s.redisClient.WithContext(ctx).HSetNX("meta:"+roomID, "pick", []byte(pick))
+	saved, err := setCmd.Result()
+	if err != nil {
+		return nil, false, err
+	}
+	go s.SetExpire(roomID)
+	if saved {
+		return pick, true, nil
+	}
+	cmd := s.redisClient.WithContext(ctx).HGet("meta:"+roomID, "pick")
+	stored, err := cmd.Bytes()
+	return stored, false, err
+}
+
+// PublishPick sends the result of a random pick to a room's subscribers
+func (s *Storage) PublishPick(ctx context.Context, roomID string, pick interface{}) error {
+	pickToSend, err := json.Marshal(pick)
+	if err != nil {
+		return err
+	}
+	return s.publish(ctx, roomID, UpdateTypePicked+"::"+string(pickToSend))
+}
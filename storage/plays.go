@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/tylerdixon/bgchooser/bggclient"
+)
+
+// playsTTL is how long a user's plays are cached before they are fetched from BGG again
+const playsTTL = time.Hour * 6
+
+// SetUserPlays caches the plays a BGG user has logged
+func (s *Storage) SetUserPlays(ctx context.Context, bggUser string, plays []bggclient.Play) error {
+	playsToStore, err := json.Marshal(plays)
+	if err != nil {
+		return err
+	}
+	cmd := s.redisClient.WithContext(ctx).Set("plays:"+bggUser, playsToStore, playsTTL)
+	return cmd.Err()
+}
+
+// GetUserPlays retrieves the cached plays of a BGG user, returning false if they aren't cached
+func (s *Storage) GetUserPlays(ctx context.Context, bggUser string) ([]bggclient.Play, bool, error) {
+	cmd := s.redisClient.WithContext(ctx).Get("plays:" + bggUser)
+	res, err := cmd.Result()
+	if err == redis.Nil {
+		return []bggclient.Play{}, false, nil
+	} else if err != nil {
+		return []bggclient.Play{}, false, err
+	}
+	var plays []bggclient.Play
+	err = json.Unmarshal([]byte(res), &plays)
+	return plays, err == nil, err
+}
+
+// GetRoomBggUsers lists the BGG users whose games are in a room, including members added from its group
+func (s *Storage) GetRoomBggUsers(ctx context.Context, roomID string) ([]string, error) {
+	cmd := s.redisClient.WithContext(ctx).HKeys("games:" + roomID)
+	owners, err := cmd.Result()
+	if err != nil {
+		return []string{}, err
+	}
+	members, err := s.GetRoomMembers(ctx, roomID)
+	if err != nil {
+		return []string{}, err
+	}
+
+	seen := make(map[string]bool)
+	bggUsers := []string{}
+	for _, member := range members {
+		owners = append(owners, member.BggUser)
+	}
+	for _, user := range owners {
+		if user != "" && !seen[user] {
+			seen[user] = true
+			bggUsers = append(bggUsers, user)
+		}
+	}
+	return bggUsers, nil
+}
@@ -0,0 +1,161 @@
+package storage
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// PresenceTTL is how long a connection counts as present in a room without being refreshed, so the
+// connections of a server that crashed drop out on their own
+const PresenceTTL = 2 * time.Minute
+
+// presenceMember identifies a single connection of a user, since a user may have the room open more than once
+func presenceMember(connID, user string) string {
+	return connID + "::" + user
+}
+
+// JoinRoom records a connection of a user as present in a room, letting the room know if the user
+// wasn't online already. The check is made in the same transaction as the connection is added, so a
+// user opening the room twice at once is only announced once.
+func (s *Storage) JoinRoom(ctx context.Context, roomID, user, connID string) error {
+	added, live, err := s.updatePresence(ctx, roomID, func(pipe redis.Pipeliner) *redis.IntCmd {
+		return pipe.ZAdd("presence:"+roomID, presenceZ(user, connID))
+	})
+	if err != nil {
+		return err
+	}
+	go s.expire("presence:" + roomID)
+	if !added || userConnections(live, user) != 1 {
+		return nil
+	}
+	return s.publish(ctx, roomID, UpdateTypeJoined+"::"+user)
+}
+
+// RefreshPresence keeps a connection counted as present in a room for another PresenceTTL. As every
+// open connection is refreshed periodically, this is also when the room's expired connections are cleared out.
+func (s *Storage) RefreshPresence(ctx context.Context, roomID, user, connID string) error {
+	cmd := s.redisClient.WithContext(ctx).ZAdd("presence:"+roomID, presenceZ(user, connID))
+	if cmd.Err() != nil {
+		return cmd.Err()
+	}
+	go s.expire("presence:" + roomID)
+	return s.pruneExpiredPresence(ctx, roomID)
+}
+
+// LeaveRoom removes a connection of a user from a room, letting the room know if it was the user's last
+func (s *Storage) LeaveRoom(ctx context.Context, roomID, user, connID string) error {
+	return s.removeConnection(ctx, roomID, presenceMember(connID, user))
+}
+
+// GetOnlineMembers retrieves the users with a connection present in a room, sorted by name
+func (s *Storage) GetOnlineMembers(ctx context.Context, roomID string) ([]string, error) {
+	err := s.pruneExpiredPresence(ctx, roomID)
+	if err != nil {
+		return nil, err
+	}
+	res, err := s.redisClient.WithContext(ctx).ZRangeByScore("presence:"+roomID, liveConnections()).Result()
+	if err != nil {
+		return nil, err
+	}
+	return onlineMembers(res), nil
+}
+
+// pruneExpiredPresence removes the connections in a room that stopped being refreshed, such as those of
+// a server that crashed, letting the room know of any users who are no longer online
+func (s *Storage) pruneExpiredPresence(ctx context.Context, roomID string) error {
+	expired, err := s.redisClient.WithContext(ctx).ZRangeByScore("presence:"+roomID, redis.ZRangeBy{
+		Min: "-inf",
+		Max: "(" + strconv.FormatInt(time.Now().Unix(), 10),
+	}).Result()
+	if err != nil {
+		return err
+	}
+	for _, conn := range expired {
+		err = s.removeConnection(ctx, roomID, conn)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeConnection removes a connection from a room, publishing that its user left if it was their
+// last. Only whoever actually removes the connection publishes, so a user is never announced as
+// leaving twice.
+func (s *Storage) removeConnection(ctx context.Context, roomID, conn string) error {
+	removed, live, err := s.updatePresence(ctx, roomID, func(pipe redis.Pipeliner) *redis.IntCmd {
+		return pipe.ZRem("presence:"+roomID, conn)
+	})
+	if err != nil {
+		return err
+	}
+	parts := strings.SplitN(conn, "::", 2)
+	if !removed || len(parts) != 2 || userConnections(live, parts[1]) != 0 {
+		return nil
+	}
+	return s.publish(ctx, roomID, UpdateTypeLeft+"::"+parts[1])
+}
+
+// updatePresence makes a change to a room's connections, returning whether it changed anything along
+// with the room's live connections read in the same transaction
+func (s *Storage) updatePresence(ctx context.Context, roomID string, change func(redis.Pipeliner) *redis.IntCmd) (bool, []string, error) {
+	var changeCmd *redis.IntCmd
+	var liveCmd *redis.StringSliceCmd
+	_, err := s.redisClient.WithContext(ctx).TxPipelined(func(pipe redis.Pipeliner) error {
+		changeCmd = change(pipe)
+		liveCmd = pipe.ZRangeByScore("presence:"+roomID, liveConnections())
+		return nil
+	})
+	if err != nil {
+		return false, nil, err
+	}
+	return changeCmd.Val() > 0, liveCmd.Val(), nil
+}
+
+// presenceZ is a connection's entry in a room's presence, scored by when it expires
+func presenceZ(user, connID string) redis.Z {
+	return redis.Z{
+		Score:  float64(time.Now().Add(PresenceTTL).Unix()),
+		Member: presenceMember(connID, user),
+	}
+}
+
+// liveConnections is the range of a room's presence that hasn't expired yet
+func liveConnections() redis.ZRangeBy {
+	return redis.ZRangeBy{
+		Min: strconv.FormatInt(time.Now().Unix(), 10),
+		Max: "+inf",
+	}
+}
+
+// userConnections counts how many of a room's connections belong to a user
+func userConnections(connections []string, user string) int {
+	count := 0
+	for _, conn := range connections {
+		if parts := strings.SplitN(conn, "::", 2); len(parts) == 2 && parts[1] == user {
+			count++
+		}
+	}
+	return count
+}
+
+// onlineMembers lists the distinct users of a room's present connections
+func onlineMembers(connections []string) []string {
+	seen := make(map[string]bool)
+	members := []string{}
+	for _, conn := range connections {
+		parts := strings.SplitN(conn, "::", 2)
+		if len(parts) != 2 || seen[parts[1]] {
+			continue
+		}
+		seen[parts[1]] = true
+		members = append(members, parts[1])
+	}
+	sort.Strings(members)
+	return members
+}
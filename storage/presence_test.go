@@ -0,0 +1,36 @@
+package storage
+
+import (
+	. "testing"
+)
+
+func TestOnlineMembers(t *T) {
+	members := onlineMembers([]string{
+		presenceMember("conn2", "bob"),
+		presenceMember("conn1", "alice"),
+		presenceMember("conn3", "bob"),
+		"malformed",
+	})
+	if len(members) != 2 || members[0] != "alice" || members[1] != "bob" {
+		t.Errorf("expected alice and bob to be online, got %v", members)
+	}
+
+	if members := onlineMembers(nil); members == nil || len(members) != 0 {
+		t.Errorf("expected an empty list when no one is online, got %#v", members)
+	}
+}
+
+func TestUserConnections(t *T) {
+	connections := []string{
+		presenceMember("conn1", "alice"),
+		presenceMember("conn2", "bob"),
+		presenceMember("conn3", "alice"),
+		presenceMember("conn4", "al::ice"),
+		"malformed",
+	}
+	for user, expected := range map[string]int{"alice": 2, "bob": 1, "carol": 0, "al::ice": 1} {
+		if count := userConnections(connections, user); count != expected {
+			t.Errorf("expected %s to have %d connections, got %d", user, expected, count)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tylerdixon/bgchooser/bggclient"
+)
+
+const (
+	// maxChosenGames is how many chosen games are remembered for each set of BGG users
+	maxChosenGames = 100
+	// recencyBoost is the most a long-unplayed game's score can be boosted by
+	recencyBoost = 0.5
+	// recencyBoostDays is how long it takes for a game to receive the full boost after it was last chosen
+	recencyBoostDays = 90
+)
+
+// RankMode represents what a room's games are ranked by
+type RankMode string
+
+const (
+	RankModeVotes  RankMode = "votes"
+	RankModeRating RankMode = "rating"
+)
+
+// RankOptions configures how a room's games are ranked
+type RankOptions struct {
+	Mode RankMode
+	// Sessions is how many of the most recent sessions recently chosen games are penalized for, with 0 disabling recency weighting
+	Sessions int
+	Chosen   []ChosenGame
+	Ratings  map[string]GroupRating
+	Now      time.Time
+}
+
+// ChosenGame represents a game that a room chose to play
+type ChosenGame struct {
+	GameID string    `json:"gameID"`
+	Date   time.Time `json:"date"`
+}
+
+// RankedGame represents a game's position in a room's ranking, along with how recently choosing it changed its score
+type RankedGame struct {
+	GameTally
+	Rating     *GroupRating `json:"rating,omitempty"`
+	Adjustment float64      `json:"adjustment"`
+	Score      float64      `json:"score"`
+}
+
+// userSetKey identifies the rooms that share the same set of BGG users, regardless of their order
+func (s *Storage) userSetKey(ctx context.Context, roomID string) (string, error) {
+	cmd := s.redisClient.WithContext(ctx).HKeys("games:" + roomID)
+	users, err := cmd.Result()
+	if err != nil {
+		return "", err
+	}
+	sort.Strings(users)
+	sum := sha1.Sum([]byte(strings.Join(users, itemSep)))
+	return "chosen:" + hex.EncodeToString(sum[:]), nil
+}
+
+// RecordChosenGame remembers that a room chose a game, for every room with the same set of BGG users
+func (s *Storage) RecordChosenGame(ctx context.Context, roomID, gameID string) error {
+	key, err := s.userSetKey(ctx, roomID)
+	if err != nil {
+		return err
+	}
+	chosen, err := json.Marshal(ChosenGame{
+		GameID: gameID,
+		Date:   time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	cmd := s.redisClient.WithContext(ctx).LPush(key, chosen)
+	err = cmd.Err()
+	if err != nil {
+		return err
+	}
+	trimCmd := s.redisClient.WithContext(ctx).LTrim(key, 0, maxChosenGames-1)
+	return trimCmd.Err()
+}
+
+// GetChosenGames retrieves the games chosen by rooms with the same set of BGG users as a room, most recent first
+func (s *Storage) GetChosenGames(ctx context.Context, roomID string) ([]ChosenGame, error) {
+	key, err := s.userSetKey(ctx, roomID)
+	if err != nil {
+		return []ChosenGame{}, err
+	}
+	cmd := s.redisClient.WithContext(ctx).LRange(key, 0, -1)
+	res, err := cmd.Result()
+	if err != nil {
+		return []ChosenGame{}, err
+	}
+	chosen := make([]ChosenGame, 0, len(res))
+	for _, c := range res {
+		var game ChosenGame
+		err := json.Unmarshal([]byte(c), &game)
+		if err != nil {
+			return chosen, err
+		}
+		chosen = append(chosen, game)
+	}
+	return chosen, nil
+}
+
+// RankGames orders a room's games by their votes, or by the group's mean rating in rating mode.
+// When opts.Sessions is positive, games chosen within that many of the most recent sessions are
+// penalized by up to a point, with the most recent choice penalized most, and games last chosen
+// longer ago than that are boosted. Games that have never been chosen get the full boost.
+func RankGames(games []bggclient.Game, votes VoteResult, opts RankOptions) []RankedGame {
+	tallies := make(map[string]GameTally)
+	for _, tally := range votes.Tally() {
+		tallies[tally.GameID] = tally
+	}
+
+	adjustments := make(map[string]float64)
+	if opts.Sessions > 0 {
+		for i, c := range opts.Chosen {
+			if _, ok := adjustments[c.GameID]; ok {
+				continue
+			}
+			if i < opts.Sessions {
+				adjustments[c.GameID] = -float64(opts.Sessions-i) / float64(opts.Sessions)
+			} else {
+				days := opts.Now.Sub(c.Date).Hours() / 24
+				if days > recencyBoostDays {
+					days = recencyBoostDays
+				}
+				adjustments[c.GameID] = recencyBoost * days / recencyBoostDays
+			}
+		}
+	}
+
+	seen := make(map[string]bool)
+	ranking := []RankedGame{}
+	for _, game := range games {
+		if seen[game.ID] {
+			continue
+		}
+		seen[game.ID] = true
+		tally, ok := tallies[game.ID]
+		if !ok {
+			tally = GameTally{GameID: game.ID}
+		}
+		ranked := RankedGame{
+			GameTally:  tally,
+			Adjustment: adjustments[game.ID],
+		}
+		if _, chosen := adjustments[game.ID]; !chosen && opts.Sessions > 0 {
+			ranked.Adjustment = recencyBoost
+		}
+		if rating, ok := opts.Ratings[game.ID]; ok {
+			ranked.Rating = &rating
+		}
+		if opts.Mode == RankModeRating {
+			if ranked.Rating != nil {
+				ranked.Score = ranked.Rating.Mean
+			}
+		} else {
+			ranked.Score = float64(tally.Votes)
+		}
+		ranked.Score += ranked.Adjustment
+		ranking = append(ranking, ranked)
+	}
+	sort.SliceStable(ranking, func(i, j int) bool {
+		if ranking[i].Score != ranking[j].Score {
+			return ranking[i].Score > ranking[j].Score
+		}
+		if ranking[i].Votes != ranking[j].Votes {
+			return ranking[i].Votes > ranking[j].Votes
+		}
+		if ranking[i].Vetoes != ranking[j].Vetoes {
+			return ranking[i].Vetoes < ranking[j].Vetoes
+		}
+		return ranking[i].GameID < ranking[j].GameID
+	})
+	return ranking
+}
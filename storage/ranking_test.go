@@ -0,0 +1,91 @@
+package storage
+
+import (
+	. "testing"
+	"time"
+
+	"github.com/tylerdixon/bgchooser/bggclient"
+)
+
+func TestRankGamesWithRecency(t *T) {
+	now := time.Date(2020, 3, 10, 20, 0, 0, 0, time.UTC)
+	games := []bggclient.Game{{ID: "1"}, {ID: "2"}, {ID: "3"}, {ID: "4"}}
+	votes := VoteResult{
+		Votes: map[string][]string{
+			"alice": {"1", "2", "3"},
+			"bob":   {"1"},
+		},
+	}
+	chosen := []ChosenGame{
+		{GameID: "1", Date: now.Add(-7 * 24 * time.Hour)},
+		{GameID: "2", Date: now.Add(-14 * 24 * time.Hour)},
+		{GameID: "3", Date: now.Add(-180 * 24 * time.Hour)},
+	}
+
+	ranking := RankGames(games, votes, RankOptions{Sessions: 2, Chosen: chosen, Now: now})
+	expected := []struct {
+		id         string
+		adjustment float64
+	}{
+		{"3", 0.5},
+		{"1", -1},
+		{"2", -0.5},
+		{"4", 0.5},
+	}
+	if len(ranking) != len(expected) {
+		t.Fatalf("expected %d ranked games, got %+v", len(expected), ranking)
+	}
+	for i, e := range expected {
+		if ranking[i].GameID != e.id || ranking[i].Adjustment != e.adjustment {
+			t.Errorf("expected rank %d to be %s adjusted by %v, got %+v", i, e.id, e.adjustment, ranking[i])
+		}
+	}
+
+	unweighted := RankGames(games, votes, RankOptions{Chosen: chosen, Now: now})
+	if unweighted[0].GameID != "1" || unweighted[0].Adjustment != 0 {
+		t.Errorf("expected game 1 to rank first without weighting, got %+v", unweighted[0])
+	}
+}
+
+func TestRankGamesBoostsNeverChosen(t *T) {
+	now := time.Date(2020, 3, 10, 20, 0, 0, 0, time.UTC)
+	games := []bggclient.Game{{ID: "1"}, {ID: "2"}, {ID: "3"}}
+	chosen := []ChosenGame{
+		{GameID: "1", Date: now.Add(-7 * 24 * time.Hour)},
+		{GameID: "2", Date: now.Add(-30 * 24 * time.Hour)},
+	}
+
+	ranking := RankGames(games, VoteResult{}, RankOptions{Sessions: 1, Chosen: chosen, Now: now})
+	if ranking[0].GameID != "3" || ranking[0].Adjustment != recencyBoost {
+		t.Errorf("expected the never chosen game to rank first with the full boost, got %+v", ranking[0])
+	}
+	if ranking[1].GameID != "2" || ranking[1].Adjustment >= recencyBoost {
+		t.Errorf("expected the game chosen a month ago to get a partial boost, got %+v", ranking[1])
+	}
+
+	unweighted := RankGames(games, VoteResult{}, RankOptions{Chosen: chosen, Now: now})
+	for _, ranked := range unweighted {
+		if ranked.Adjustment != 0 {
+			t.Errorf("expected no boost without weighting, got %+v", ranked)
+		}
+	}
+}
+
+func TestRankGamesByRating(t *T) {
+	games := []bggclient.Game{{ID: "1"}, {ID: "2"}, {ID: "3"}}
+	votes := VoteResult{
+		Votes: map[string][]string{"alice": {"1"}},
+	}
+	ratings := map[string]GroupRating{
+		"2": {Mean: 8.5},
+		"3": {Mean: 6},
+	}
+
+	ranking := RankGames(games, votes, RankOptions{Mode: RankModeRating, Ratings: ratings})
+	if ranking[0].GameID != "2" || ranking[1].GameID != "3" || ranking[2].GameID != "1" {
+		t.Errorf("expected games to be ranked 2, 3, 1 by rating, got %+v", ranking)
+	}
+	if ranking[0].Rating == nil || ranking[0].Rating.Mean != 8.5 {
+		t.Errorf("expected the group rating to be included, got %+v", ranking[0].Rating)
+	}
+}
@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+
+	"github.com/tylerdixon/bgchooser/bggclient"
+)
+
+// GroupRating aggregates the personal BGG ratings that a room's users gave a game
+type GroupRating struct {
+	Mean    float64            `json:"mean"`
+	Min     float64            `json:"min"`
+	Ratings map[string]float64 `json:"ratings"`
+	Unrated []string           `json:"unrated"`
+}
+
+// GetUserGamesForRoom retrieves the games for a room, keyed by the user who added them
+func (s *Storage) GetUserGamesForRoom(ctx context.Context, roomID string) (map[string][]bggclient.Game, error) {
+	cmd := s.redisClient.WithContext(ctx).HGetAll("games:" + roomID)
+	res, err := cmd.Result()
+	if err != nil {
+		return map[string][]bggclient.Game{}, err
+	}
+	userGames := make(map[string][]bggclient.Game)
+	for user, gamesList := range res {
+		var games []bggclient.Game
+		err := json.Unmarshal([]byte(gamesList), &games)
+		if err != nil {
+			return userGames, err
+		}
+		userGames[user] = games
+	}
+	return userGames, nil
+}
+
+// GetGroupRatings aggregates the ratings each user gave the games in their collection, keyed by game ID.
+// Users are unrated for a game if they haven't rated it or don't have it in their collection.
+func GetGroupRatings(userGames map[string][]bggclient.Game) map[string]GroupRating {
+	users := make([]string, 0, len(userGames))
+	for user := range userGames {
+		users = append(users, user)
+	}
+	sort.Strings(users)
+
+	ratings := make(map[string]map[string]float64)
+	for user, games := range userGames {
+		for _, game := range games {
+			if _, ok := ratings[game.ID]; !ok {
+				ratings[game.ID] = make(map[string]float64)
+			}
+			if game.Rating > 0 {
+				ratings[game.ID][user] = game.Rating
+			}
+		}
+	}
+
+	groupRatings := make(map[string]GroupRating)
+	for gameID, userRatings := range ratings {
+		groupRating := GroupRating{
+			Ratings: userRatings,
+			Unrated: []string{},
+		}
+		var total float64
+		for _, user := range users {
+			rating, ok := userRatings[user]
+			if !ok {
+				groupRating.Unrated = append(groupRating.Unrated, user)
+				continue
+			}
+			total += rating
+			if groupRating.Min == 0 || rating < groupRating.Min {
+				groupRating.Min = rating
+			}
+		}
+		if len(userRatings) > 0 {
+			groupRating.Mean = total / float64(len(userRatings))
+		}
+		groupRatings[gameID] = groupRating
+	}
+	return groupRatings
+}
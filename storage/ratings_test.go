@@ -0,0 +1,28 @@
+package storage
+
+import (
+	. "testing"
+
+	"github.com/tylerdixon/bgchooser/bggclient"
+)
+
+func TestGetGroupRatings(t *T) {
+	ratings := GetGroupRatings(map[string][]bggclient.Game{
+		"alice42": {{ID: "1", Rating: 8}, {ID: "2"}},
+		"bob7":    {{ID: "1", Rating: 6}},
+		"carol":   {},
+	})
+
+	azul := ratings["1"]
+	if azul.Mean != 7 || azul.Min != 6 || len(azul.Ratings) != 2 {
+		t.Errorf("expected game 1 to average 7 with a minimum of 6, got %+v", azul)
+	}
+	if len(azul.Unrated) != 1 || azul.Unrated[0] != "carol" {
+		t.Errorf("expected only carol to not have rated game 1, got %v", azul.Unrated)
+	}
+
+	catan := ratings["2"]
+	if catan.Mean != 0 || len(catan.Unrated) != 3 {
+		t.Errorf("expected nobody to have rated game 2, got %+v", catan)
+	}
+}
@@ -0,0 +1,134 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/go-redis/redis"
+)
+
+// defaultRunoffSize is how many of the previous round's top games a new round is seeded with by default
+const defaultRunoffSize = 2
+
+var (
+	ErrRoundInProgress = errors.New("the current round's votes must be revealed before starting a new round")
+	ErrNoCandidates    = errors.New("no games without vetoes received votes in the current round")
+)
+
+// Round represents the outcome of a single round of voting in a room
+type Round struct {
+	Number      int         `json:"number"`
+	Candidates  []string    `json:"candidates,omitempty"`
+	VoteResults VoteResult  `json:"voteResults"`
+	Tally       []GameTally `json:"tally"`
+	Winner      string      `json:"winner"`
+}
+
+// filterCandidates removes any games that aren't candidates in the current round. Every game
+// is a candidate when no candidates are given.
+func filterCandidates(gameIDs, candidates []string) []string {
+	if len(candidates) == 0 {
+		return gameIDs
+	}
+	var filtered []string
+	for _, gameID := range gameIDs {
+		for _, candidate := range candidates {
+			if gameID == candidate {
+				filtered = append(filtered, gameID)
+				break
+			}
+		}
+	}
+	return filtered
+}
+
+// StartRound archives the ballots of a room's current round and starts a runoff between its top games
+func (s *Storage) StartRound(ctx context.Context, roomID string, size int) (Round, error) {
+	if size <= 0 {
+		size = defaultRunoffSize
+	}
+	meta, err := s.GetRoomMeta(ctx, roomID)
+	if err != nil {
+		return Round{}, err
+	}
+	if meta.State != RoomStateRevealed && meta.State != RoomStateFinished {
+		return Round{}, ErrRoundInProgress
+	}
+
+	votes, err := s.GetUserVotes(ctx, roomID)
+	if err != nil {
+		return Round{}, err
+	}
+	previous := Round{
+		Number:      meta.Round,
+		Candidates:  meta.Candidates,
+		VoteResults: votes,
+		Tally:       votes.Tally(),
+		Winner:      votes.Winner(),
+	}
+	next := Round{
+		Number: meta.Round + 1,
+	}
+	for _, tally := range previous.Tally {
+		if len(next.Candidates) == size {
+			break
+		}
+		if tally.Votes > 0 && tally.Vetoes == 0 {
+			next.Candidates = append(next.Candidates, tally.GameID)
+		}
+	}
+	if len(next.Candidates) == 0 {
+		return Round{}, ErrNoCandidates
+	}
+
+	archived, err := json.Marshal(previous)
+	if err != nil {
+		return Round{}, err
+	}
+	// The round is archived and the next one started together, so a failure can't leave them half done
+	_, err = s.redisClient.WithContext(ctx).TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.RPush("rounds:"+roomID, archived)
+		pipe.Del("rooms:" + roomID)
+		// The new round gets its own deadline and pick
+		pipe.HDel("meta:"+roomID, "deadline", "pick")
+		pipe.ZRem(deadlinesKey, roomID)
+		pipe.HMSet("meta:"+roomID, map[string]interface{}{
+			"round":      next.Number,
+			"candidates": strings.Join(next.Candidates, itemSep),
+			"state":      string(RoomStateVoting),
+		})
+		return nil
+	})
+	if err != nil {
+		return Round{}, err
+	}
+	go s.SetExpire(roomID)
+
+	err = s.publish(ctx, roomID, UpdateTypeResetVotes)
+	if err != nil {
+		return Round{}, err
+	}
+	return next, s.publish(ctx, roomID, UpdateTypeNewRound+"::"+strconv.Itoa(next.Number)+"::"+strings.Join(next.Candidates, itemSep))
+}
+
+// GetRounds retrieves the outcome of every previous round in a room, oldest first
+func (s *Storage) GetRounds(ctx context.Context, roomID string) ([]Round, error) {
+	cmd := s.redisClient.WithContext(ctx).LRange("rounds:"+roomID, 0, -1)
+	res, err := cmd.Result()
+	if err != nil {
+		return []Round{}, err
+	}
+	rounds := make([]Round, 0, len(res))
+	for _, r := range res {
+		var round Round
+		err := json.Unmarshal([]byte(r), &round)
+		if err != nil {
+			return rounds, err
+		}
+		rounds = append(rounds, round)
+	}
+	return rounds, nil
+}
@@ -0,0 +1,309 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// RoomState represents the phase a room's vote is currently in
+type RoomState string
+
+const (
+	RoomStateCollecting RoomState = "collecting"
+	RoomStateVoting     RoomState = "voting"
+	RoomStateRevealed   RoomState = "revealed"
+	RoomStateFinished   RoomState = "finished"
+)
+
+// nextRoomState maps each state to the only state it may move forward to
+var nextRoomState = map[RoomState]RoomState{
+	RoomStateCollecting: RoomStateVoting,
+	RoomStateVoting:     RoomStateRevealed,
+	RoomStateRevealed:   RoomStateFinished,
+}
+
+var (
+	ErrInvalidTransition = errors.New("invalid room state transition")
+	ErrNominationsClosed = errors.New("games can no longer be added once voting has started")
+	ErrVotingClosed      = errors.New("votes can no longer be changed once they have been revealed")
+	ErrInvalidDeadline   = errors.New("deadline must be in the future and before the room expires")
+)
+
+// deadlinesKey is a sorted set of room IDs scored by the unix time their voting deadline passes
+const deadlinesKey = "deadlines"
+
+// RoomMeta represents the stored state of a room and the key required to manage it
+type RoomMeta struct {
+	State      RoomState `json:"state"`
+	HostKey    string    `json:"-"`
+	Deadline   time.Time `json:"-"`
+	Round      int       `json:"round"`
+	Candidates []string  `json:"candidates,omitempty"`
+	GroupID    string    `json:"groupID,omitempty"`
+	// PickSeed is the seed committed to for the room's next random pick, which mustn't be revealed before it's used
+	PickSeed string `json:"-"`
+	// Pick is the random pick made for the current round, if one has been
+	Pick json.RawMessage `json:"-"`
+}
+
+// VotingOpen returns whether votes can still be changed at the given time
+func (m RoomMeta) VotingOpen(now time.Time) bool {
+	if m.State == RoomStateRevealed || m.State == RoomStateFinished {
+		return false
+	}
+	return m.Deadline.IsZero() || now.Before(m.Deadline)
+}
+
+// CreateRoom stores the initial state for a room along with the key its host manages it with
+// and the group, if any, whose history it should be recorded in
+func (s *Storage) CreateRoom(ctx context.Context, roomID, hostKey, groupID string) error {
+	cmd := s.redisClient.WithContext(ctx).HMSet("meta:"+roomID, map[string]interface{}{
+		"state":   string(RoomStateCollecting),
+		"hostKey": hostKey,
+		"groupID": groupID,
+	})
+	err := cmd.Err()
+	if err != nil {
+		return err
+	}
+	go s.SetExpire(roomID)
+	return nil
+}
+
+// GetRoomMeta retrieves the state of a room. Rooms without any stored state are still collecting games.
+func (s *Storage) GetRoomMeta(ctx context.Context, roomID string) (RoomMeta, error) {
+	cmd := s.redisClient.WithContext(ctx).HGetAll("meta:" + roomID)
+	res, err := cmd.Result()
+	if err != nil {
+		return RoomMeta{}, err
+	}
+	meta := RoomMeta{
+		State:    RoomState(res["state"]),
+		HostKey:  res["hostKey"],
+		GroupID:  res["groupID"],
+		PickSeed: res["pickSeed"],
+	}
+	if meta.State == "" {
+		meta.State = RoomStateCollecting
+	}
+	if deadline, err := strconv.ParseInt(res["deadline"], 10, 64); err == nil {
+		meta.Deadline = time.Unix(deadline, 0)
+	}
+	meta.Round, err = strconv.Atoi(res["round"])
+	if err != nil {
+		meta.Round = 1
+	}
+	if res["candidates"] != "" {
+		meta.Candidates = strings.Split(res["candidates"], itemSep)
+	}
+	if res["pick"] != "" {
+		meta.Pick = json.RawMessage(res["pick"])
+	}
+	return meta, nil
+}
+
+// SetRoomState moves a room forward to the given state, notifying subscribers of the change
+func (s *Storage) SetRoomState(ctx context.Context, roomID string, state RoomState) error {
+	meta, err := s.GetRoomMeta(ctx, roomID)
+	if err != nil {
+		return err
+	}
+	if nextRoomState[meta.State] != state {
+		return ErrInvalidTransition
+	}
+	return s.setRoomState(ctx, roomID, state)
+}
+
+func (s *Storage) setRoomState(ctx context.Context, roomID string, state RoomState) error {
+	cmd := s.redisClient.WithContext(ctx).HSet("meta:"+roomID, "state", string(state))
+	err := cmd.Err()
+	if err != nil {
+		return err
+	}
+	go s.SetExpire(roomID)
+
+	if state == RoomStateRevealed {
+		// Revealing early makes any pending deadline moot
+		s.redisClient.WithContext(ctx).ZRem(deadlinesKey, roomID)
+	}
+	return s.announceState(ctx, roomID, state)
+}
+
+// announceState lets a room's subscribers know it moved to a state, sending every ballot once it's revealed
+func (s *Storage) announceState(ctx context.Context, roomID string, state RoomState) error {
+	err := s.publish(ctx, roomID, UpdateTypeStateChanged+"::"+string(state))
+	if err != nil {
+		return err
+	}
+	if state == RoomStateRevealed {
+		return s.publishBallots(ctx, roomID)
+	}
+	return nil
+}
+
+// SetRoomDeadline sets the time at which voting in a room automatically closes
+func (s *Storage) SetRoomDeadline(ctx context.Context, roomID string, deadline time.Time) error {
+	if !deadline.After(time.Now()) || deadline.After(time.Now().Add(s.roomTTL)) {
+		return ErrInvalidDeadline
+	}
+	meta, err := s.GetRoomMeta(ctx, roomID)
+	if err != nil {
+		return err
+	}
+	if !meta.VotingOpen(time.Now()) {
+		return ErrVotingClosed
+	}
+
+	cmd := s.redisClient.WithContext(ctx).HSet("meta:"+roomID, "deadline", deadline.Unix())
+	err = cmd.Err()
+	if err != nil {
+		return err
+	}
+	go s.SetExpire(roomID)
+
+	zCmd := s.redisClient.WithContext(ctx).ZAdd(deadlinesKey, redis.Z{
+		Score:  float64(deadline.Unix()),
+		Member: roomID,
+	})
+	return zCmd.Err()
+}
+
+// GetDueDeadlines returns the IDs of rooms whose voting deadline has passed but have not yet been closed
+func (s *Storage) GetDueDeadlines(ctx context.Context, now time.Time) ([]string, error) {
+	cmd := s.redisClient.WithContext(ctx).ZRangeByScore(deadlinesKey, redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(now.Unix(), 10),
+	})
+	return cmd.Result()
+}
+
+// closeRoundScript reveals a room's votes if its deadline is still due, removing the deadline in the
+// same step. It returns -1 if the deadline was already closed or moved, 1 if the votes were revealed,
+// and 0 if they had been revealed already. As the deadline is only removed along with the state
+// change, a failure part way through leaves it to be closed on the next poll.
+var closeRoundScript = redis.NewScript(`
+local due = redis.call('ZSCORE', KEYS[1], ARGV[1])
+if not due or tonumber(due) > tonumber(ARGV[2]) then
+	return -1
+end
+local state = redis.call('HGET', KEYS[2], 'state')
+local revealed = 0
+if not state or state == 'collecting' or state == 'voting' then
+	redis.call('HSET', KEYS[2], 'state', 'revealed')
+	revealed = 1
+end
+redis.call('ZREM', KEYS[1], ARGV[1])
+return revealed
+`)
+
+// CloseRound reveals the votes for a room whose deadline has passed and announces the winner.
+// Only one caller can close a given deadline, so it returns false if the round was already closed elsewhere.
+func (s *Storage) CloseRound(ctx context.Context, roomID string) (string, bool, error) {
+	keys := []string{deadlinesKey, "meta:" + roomID}
+	revealed, err := closeRoundScript.Run(s.redisClient.WithContext(ctx), keys, roomID, time.Now().Unix()).Int()
+	if err != nil || revealed < 0 {
+		return "", false, err
+	}
+	if revealed == 1 {
+		go s.SetExpire(roomID)
+		err = s.announceState(ctx, roomID, RoomStateRevealed)
+		if err != nil {
+			return "", true, err
+		}
+	}
+
+	votes, err := s.GetUserVotes(ctx, roomID)
+	if err != nil {
+		return "", true, err
+	}
+	winner := votes.Winner()
+	return winner, true, s.publish(ctx, roomID, UpdateTypeRoundClosed+"::"+winner)
+}
+
+// publishBallots sends every user's votes to subscribers, which only happens once a room's votes are revealed
+func (s *Storage) publishBallots(ctx context.Context, roomID string) error {
+	cmd := s.redisClient.WithContext(ctx).HGetAll("rooms:" + roomID)
+	res, err := cmd.Result()
+	if err != nil {
+		return err
+	}
+	for user, ballot := range res {
+		err = s.publish(ctx, roomID, UpdateTypeAddedVotes+"::"+user+"::"+ballot)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// VoteProgress represents how many of a room's members have submitted a ballot
+type VoteProgress struct {
+	Voted   int `json:"voted"`
+	Members int `json:"members"`
+}
+
+// GetVoteProgress counts the members of a room who have voted
+func (s *Storage) GetVoteProgress(ctx context.Context, roomID string) (VoteProgress, error) {
+	votersCmd := s.redisClient.WithContext(ctx).HLen("rooms:" + roomID)
+	voters, err := votersCmd.Result()
+	if err != nil {
+		return VoteProgress{}, err
+	}
+	members, err := s.roomMembers(ctx, roomID)
+	if err != nil {
+		return VoteProgress{}, err
+	}
+	return VoteProgress{
+		Voted:   int(voters),
+		Members: len(members),
+	}, nil
+}
+
+// roomMembers lists the members of a room, which are everyone who has added games, voted, or
+// was added to the room from its group
+func (s *Storage) roomMembers(ctx context.Context, roomID string) ([]string, error) {
+	votersCmd := s.redisClient.WithContext(ctx).HKeys("rooms:" + roomID)
+	voters, err := votersCmd.Result()
+	if err != nil {
+		return []string{}, err
+	}
+	ownersCmd := s.redisClient.WithContext(ctx).HKeys("games:" + roomID)
+	owners, err := ownersCmd.Result()
+	if err != nil {
+		return []string{}, err
+	}
+	added, err := s.GetRoomMembers(ctx, roomID)
+	if err != nil {
+		return []string{}, err
+	}
+
+	// Members added from a group own games under their BGG user, so they are only counted by name
+	seen := make(map[string]bool)
+	members := []string{}
+	for _, member := range added {
+		seen[member.Name] = true
+		seen[member.BggUser] = true
+		members = append(members, member.Name)
+	}
+	for _, user := range append(voters, owners...) {
+		if !seen[user] {
+			seen[user] = true
+			members = append(members, user)
+		}
+	}
+	return members, nil
+}
+
+func (s *Storage) publishVoteProgress(ctx context.Context, roomID string) error {
+	progress, err := s.GetVoteProgress(ctx, roomID)
+	if err != nil {
+		return err
+	}
+	return s.publish(ctx, roomID, UpdateTypeVoteProgress+"::"+strconv.Itoa(progress.Voted)+"::"+strconv.Itoa(progress.Members))
+}
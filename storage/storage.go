@@ -1,15 +1,19 @@
 package storage
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
-	"flag"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/go-redis/redis"
 	"github.com/tylerdixon/bgchooser/bggclient"
+	"github.com/tylerdixon/bgchooser/config"
 )
 
 const itemSep = ";;"
@@ -18,45 +22,66 @@ const itemSep = ";;"
 type UpdateType string
 
 const (
-	UpdateTypeAddedGames UpdateType = "addedGamesUpdate"
-	UpdateTypeAddedVotes            = "addedVotesUpdate"
-	UpdateTypeResetVotes            = "resetVotesUpdate"
+	UpdateTypeAddedGames   UpdateType = "addedGamesUpdate"
+	UpdateTypeAddedVotes              = "addedVotesUpdate"
+	UpdateTypeResetVotes              = "resetVotesUpdate"
+	UpdateTypeStateChanged            = "stateChangedUpdate"
+	UpdateTypeVoteProgress            = "voteProgressUpdate"
+	UpdateTypeRoundClosed             = "roundClosedUpdate"
+	UpdateTypeNewRound                = "newRoundUpdate"
+	UpdateTypeTables                  = "tablesUpdate"
+	UpdateTypePicked                  = "pickedUpdate"
+	UpdateTypeJoined                  = "joinedUpdate"
+	UpdateTypeLeft                    = "leftUpdate"
 )
 
 type Storage struct {
 	redisClient *redis.Client
+	roomTTL     time.Duration
 }
 
-var redisAddr string
-
-const roomTTL = time.Hour * 24 * 14
-
-func init() {
-	flag.StringVar(&redisAddr, "redis-addr", "localhost:6379", "Address to access redis by")
-}
-
-// New creates a new instance of Storage
-func New() (Storage, error) {
-	client := redis.NewClient(&redis.Options{
-		Addr:     redisAddr,
-		Password: "", // no password set
-		DB:       0,  // use default DB
-	})
+// New creates a new instance of Storage, connected to the configured redis
+func New(cfg config.Config) (Storage, error) {
+	opts := &redis.Options{
+		Addr:     cfg.Redis.Addr,
+		Password: cfg.Redis.Password,
+		DB:       cfg.Redis.DB,
+	}
+	if cfg.Redis.TLS {
+		opts.TLSConfig = &tls.Config{}
+	}
+	client := redis.NewClient(opts)
 
 	_, err := client.Ping().Result()
 	return Storage{
 		redisClient: client,
+		roomTTL:     cfg.RoomTTL,
 	}, err
 }
 
-// SetExpire sets the expiration for all entries related to a roomID
+// Ping checks that redis can be reached
+func (s *Storage) Ping(ctx context.Context) error {
+	return s.redisClient.WithContext(ctx).Ping().Err()
+}
+
+// Close closes the connection to redis, along with any room subscriptions still open
+func (s *Storage) Close() error {
+	return s.redisClient.Close()
+}
+
+// SetExpire sets the expiration for all entries related to a roomID. It's run in the background once a
+// room has been touched, so it isn't tied to the context of the request that touched it.
 func (s *Storage) SetExpire(roomID string) {
 	s.expire("games:" + roomID)
 	s.expire("rooms:" + roomID)
+	s.expire("meta:" + roomID)
+	s.expire("rounds:" + roomID)
+	s.expire("members:" + roomID)
+	s.expire("voters:" + roomID)
 }
 
 func (s *Storage) expire(key string) {
-	cmd := s.redisClient.Expire(key, roomTTL)
+	cmd := s.redisClient.Expire(key, s.roomTTL)
 
 	res, err := cmd.Result()
 
@@ -69,8 +94,16 @@ func (s *Storage) expire(key string) {
 }
 
 // AddGamesToRoom takes a adds an hash a set of games to a hash keyed by the user
-func (s *Storage) AddGamesToRoom(roomID, bggUser string, games []bggclient.Game) error {
-	getGamesCmd := s.redisClient.HGet("games:"+roomID, bggUser)
+func (s *Storage) AddGamesToRoom(ctx context.Context, roomID, bggUser string, games []bggclient.Game) error {
+	meta, err := s.GetRoomMeta(ctx, roomID)
+	if err != nil {
+		return err
+	}
+	if meta.State != RoomStateCollecting {
+		return ErrNominationsClosed
+	}
+
+	getGamesCmd := s.redisClient.WithContext(ctx).HGet("games:"+roomID, bggUser)
 	getGamesRes, err := getGamesCmd.Result()
 	if err != nil && err != redis.Nil {
 		return err
@@ -84,20 +117,19 @@ func (s *Storage) AddGamesToRoom(roomID, bggUser string, games []bggclient.Game)
 	if err != nil {
 		return err
 	}
-	cmd := s.redisClient.HSet("games:"+roomID, bggUser, gamesToStore)
+	cmd := s.redisClient.WithContext(ctx).HSet("games:"+roomID, bggUser, gamesToStore)
 	err = cmd.Err()
 	if err != nil {
 		return err
 	}
 	go s.SetExpire(roomID)
 	// TODO: Maybe should only log error on publish fail?
-	pubCmd := s.redisClient.Publish("room:"+roomID, string(UpdateTypeAddedGames)+"::"+bggUser+"::"+string(gamesToStore))
-	return pubCmd.Err()
+	return s.publish(ctx, roomID, string(UpdateTypeAddedGames)+"::"+bggUser+"::"+string(gamesToStore))
 }
 
 // GetGamesForRom retrieves all of the games for a room
-func (s *Storage) GetGamesForRoom(roomID string) ([]bggclient.Game, error) {
-	cmd := s.redisClient.HGetAll("games:" + roomID)
+func (s *Storage) GetGamesForRoom(ctx context.Context, roomID string) ([]bggclient.Game, error) {
+	cmd := s.redisClient.WithContext(ctx).HGetAll("games:" + roomID)
 	res, err := cmd.Result()
 	if err != nil {
 		return []bggclient.Game{}, err
@@ -115,19 +147,27 @@ func (s *Storage) GetGamesForRoom(roomID string) ([]bggclient.Game, error) {
 	return gamesToReturn, nil
 }
 
-// SetUserVotes sets the votes and vetoes for a user
-func (s *Storage) SetUserVotes(roomID, user string, votes, vetoes []string) error {
-	votesString := strings.Join(votes, itemSep)
-	vetoesString := strings.Join(vetoes, itemSep)
-	cmd := s.redisClient.HSet("rooms:"+roomID, user, votesString+"::"+vetoesString)
-	err := cmd.Err()
+// SetUserVotes sets the votes and vetoes for a user. Until the room's votes are revealed, subscribers
+// are only told how many members have voted rather than what they voted for.
+func (s *Storage) SetUserVotes(ctx context.Context, roomID, user string, votes, vetoes []string) error {
+	meta, err := s.GetRoomMeta(ctx, roomID)
+	if err != nil {
+		return err
+	}
+	if !meta.VotingOpen(time.Now()) {
+		return ErrVotingClosed
+	}
+
+	votesString := strings.Join(filterCandidates(votes, meta.Candidates), itemSep)
+	vetoesString := strings.Join(filterCandidates(vetoes, meta.Candidates), itemSep)
+	cmd := s.redisClient.WithContext(ctx).HSet("rooms:"+roomID, user, votesString+"::"+vetoesString)
+	err = cmd.Err()
 	if err != nil {
 		return err
 	}
 	go s.SetExpire(roomID)
 
-	pubCmd := s.redisClient.Publish("room:"+roomID, UpdateTypeAddedVotes+"::"+user+"::"+votesString+"::"+vetoesString)
-	return pubCmd.Err()
+	return s.publishVoteProgress(ctx, roomID)
 }
 
 // VoteResult represents a map of user ID to a list of games they voted for
@@ -137,9 +177,9 @@ type VoteResult struct {
 }
 
 // GetUserVotes returns a the vote result for a user
-func (s *Storage) GetUserVotes(roomID string) (VoteResult, error) {
+func (s *Storage) GetUserVotes(ctx context.Context, roomID string) (VoteResult, error) {
 	var voteRes VoteResult
-	cmd := s.redisClient.HGetAll("rooms:" + roomID)
+	cmd := s.redisClient.WithContext(ctx).HGetAll("rooms:" + roomID)
 	res, err := cmd.Result()
 	if err != nil {
 		return voteRes, err
@@ -161,30 +201,88 @@ func (s *Storage) GetUserVotes(roomID string) (VoteResult, error) {
 	return voteRes, nil
 }
 
-// ResetRoomVotes removes all current votes for a room
-func (s *Storage) ResetRoomVotes(roomID string) error {
-	cmd := s.redisClient.Del("rooms:" + roomID)
-	err := cmd.Err()
+// resetMetaFields lists the fields of a room's meta that a reset of its votes clears. The pick was
+// drawn from the discarded ballots, and a deadline that closed the round would otherwise keep the
+// reopened voting closed.
+func resetMetaFields(state RoomState) []string {
+	if state == RoomStateRevealed || state == RoomStateFinished {
+		return []string{"deadline", "pick"}
+	}
+	return []string{"pick"}
+}
+
+// ResetRoomVotes removes all current votes for a room, along with any pick made from them, reopening
+// voting without a deadline if the votes had been revealed
+func (s *Storage) ResetRoomVotes(ctx context.Context, roomID string) error {
+	meta, err := s.GetRoomMeta(ctx, roomID)
 	if err != nil {
 		return err
 	}
 
-	pubCmd := s.redisClient.Publish("room:"+roomID, UpdateTypeResetVotes)
-	return pubCmd.Err()
+	_, err = s.redisClient.WithContext(ctx).TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.Del("rooms:" + roomID)
+		pipe.HDel("meta:"+roomID, resetMetaFields(meta.State)...)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	err = s.publish(ctx, roomID, UpdateTypeResetVotes)
+	if err != nil {
+		return err
+	}
+	if meta.State == RoomStateRevealed || meta.State == RoomStateFinished {
+		err = s.redisClient.WithContext(ctx).ZRem(deadlinesKey, roomID).Err()
+		if err != nil {
+			return err
+		}
+		return s.setRoomState(ctx, roomID, RoomStateVoting)
+	}
+	return nil
+}
+
+// PublishTables sends a proposed split of a room's members into tables to its subscribers
+func (s *Storage) PublishTables(ctx context.Context, roomID string, tables interface{}) error {
+	tablesToSend, err := json.Marshal(tables)
+	if err != nil {
+		return err
+	}
+	return s.publish(ctx, roomID, UpdateTypeTables+"::"+string(tablesToSend))
 }
 
 // RoomSubscriptionMessage represents a message for when a room is updated
 type RoomSubscriptionMessage struct {
-	Type   UpdateType       `json:"type"`
-	Games  []bggclient.Game `json:"games"`
-	Votes  []string         `json:"votes"`
-	Vetoes []string         `json:"vetoes"`
-	User   string           `json:"user"`
+	Type       UpdateType       `json:"type"`
+	Games      []bggclient.Game `json:"games"`
+	Votes      []string         `json:"votes"`
+	Vetoes     []string         `json:"vetoes"`
+	User       string           `json:"user"`
+	State      RoomState        `json:"state,omitempty"`
+	Progress   *VoteProgress    `json:"progress,omitempty"`
+	Winner     string           `json:"winner,omitempty"`
+	Round      int              `json:"round,omitempty"`
+	Candidates []string         `json:"candidates,omitempty"`
+	Tables     json.RawMessage  `json:"tables,omitempty"`
+	Pick       json.RawMessage  `json:"pick,omitempty"`
+	// Seq numbers the room's updates in the order they were published, starting from 1
+	Seq int64 `json:"seq,omitempty"`
+	// RoomID is set when the message is forwarded to a websocket, which may be subscribed to several rooms
+	RoomID string `json:"roomID,omitempty"`
 }
 
-// SubscribeToRoomInfo sets up a subscription to updates for a room, calling the watchFn whenever an update is published
+// subscribeTimeout is how long to wait for Redis to confirm a subscription to a room
+const subscribeTimeout = 5 * time.Second
+
+// SubscribeToRoomInfo sets up a subscription to updates for a room, calling the watchFn whenever an update
+// is published. It returns once Redis has confirmed the subscription, so no update published afterwards
+// is missed. If it isn't confirmed in time, the subscription carries on being set up in the background.
 func (s *Storage) SubscribeToRoomInfo(roomID string, watchFn func(RoomSubscriptionMessage)) func() error {
 	pubsub := s.redisClient.Subscribe("room:" + roomID)
+	activeSubscriptions.Inc()
+	if _, err := pubsub.ReceiveTimeout(subscribeTimeout); err != nil {
+		log.Warn(log.Fields{"roomID": roomID, "err": err}, "Subscription to room not confirmed")
+	}
 	channel := pubsub.Channel()
 	go func() {
 		for {
@@ -192,46 +290,122 @@ func (s *Storage) SubscribeToRoomInfo(roomID string, watchFn func(RoomSubscripti
 			if msg == nil {
 				return
 			}
-			// TODO: Validate parts
-			parts := strings.Split(msg.Payload, "::")
-			if len(parts) == 0 {
-				log.Println("Error, malformed pubsub message: " + msg.Payload)
-				return
-			}
-			switch UpdateType(parts[0]) {
-			case UpdateTypeAddedGames:
-				if len(parts) != 3 {
-					log.Println("Error, malformed pubsub added games message: " + msg.Payload)
-				}
-				var games []bggclient.Game
-				err := json.Unmarshal([]byte(parts[2]), &games)
-				if err != nil {
-					log.Println("Error, malformed games in added games message: " + msg.Payload)
-				}
-				watchFn(RoomSubscriptionMessage{
-					Type:  UpdateType(parts[0]),
-					User:  parts[1],
-					Games: games,
-				})
-			case UpdateTypeAddedVotes:
-				if len(parts) != 4 {
-					log.Println("Error, malformed pubsub added votes message: " + msg.Payload)
-				}
-				watchFn(RoomSubscriptionMessage{
-					Type:   UpdateType(parts[0]),
-					User:   parts[1],
-					Votes:  strings.Split(parts[2], itemSep),
-					Vetoes: strings.Split(parts[3], itemSep),
-				})
-			case UpdateTypeResetVotes:
-				watchFn(RoomSubscriptionMessage{
-					Type: UpdateType(parts[0]),
-				})
+			seq, roomMsg, err := parseRoomEvent(msg.Payload)
+			if err != nil {
+				log.Warn(log.Fields{"roomID": roomID, "payload": msg.Payload, "err": err}, "Malformed pubsub message")
+				continue
 			}
+			roomMsg.Seq = seq
+			watchFn(roomMsg)
 		}
 	}()
 
+	var once sync.Once
 	return func() error {
+		once.Do(activeSubscriptions.Dec)
 		return pubsub.Close()
 	}
 }
+
+// parseRoomMessage parses a room update from the form it's published and logged in. User names and
+// the JSON of games, tables and picks may contain the separator, so those fields are kept whole.
+func parseRoomMessage(payload string) (RoomSubscriptionMessage, error) {
+	parts := strings.Split(payload, "::")
+	if len(parts) == 0 {
+		return RoomSubscriptionMessage{}, errMalformedMessage
+	}
+	switch UpdateType(parts[0]) {
+	case UpdateTypeAddedGames:
+		parts = strings.SplitN(payload, "::", 3)
+		if len(parts) != 3 {
+			return RoomSubscriptionMessage{}, errMalformedMessage
+		}
+		var games []bggclient.Game
+		err := json.Unmarshal([]byte(parts[2]), &games)
+		if err != nil {
+			return RoomSubscriptionMessage{}, errMalformedMessage
+		}
+		return RoomSubscriptionMessage{
+			Type:  UpdateType(parts[0]),
+			User:  parts[1],
+			Games: games,
+		}, nil
+	case UpdateTypeAddedVotes:
+		if len(parts) < 4 {
+			return RoomSubscriptionMessage{}, errMalformedMessage
+		}
+		// Game IDs never contain the separator, so the votes and vetoes are always the last two fields
+		n := len(parts)
+		return RoomSubscriptionMessage{
+			Type:   UpdateType(parts[0]),
+			User:   strings.Join(parts[1:n-2], "::"),
+			Votes:  strings.Split(parts[n-2], itemSep),
+			Vetoes: strings.Split(parts[n-1], itemSep),
+		}, nil
+	case UpdateTypeResetVotes:
+		return RoomSubscriptionMessage{
+			Type: UpdateType(parts[0]),
+		}, nil
+	case UpdateTypeJoined, UpdateTypeLeft:
+		if len(parts) < 2 {
+			return RoomSubscriptionMessage{}, errMalformedMessage
+		}
+		return RoomSubscriptionMessage{
+			Type: UpdateType(parts[0]),
+			User: strings.Join(parts[1:], "::"),
+		}, nil
+	case UpdateTypeStateChanged:
+		if len(parts) != 2 {
+			return RoomSubscriptionMessage{}, errMalformedMessage
+		}
+		return RoomSubscriptionMessage{
+			Type:  UpdateType(parts[0]),
+			State: RoomState(parts[1]),
+		}, nil
+	case UpdateTypeVoteProgress:
+		if len(parts) != 3 {
+			return RoomSubscriptionMessage{}, errMalformedMessage
+		}
+		voted, _ := strconv.Atoi(parts[1])
+		members, _ := strconv.Atoi(parts[2])
+		return RoomSubscriptionMessage{
+			Type:     UpdateType(parts[0]),
+			Progress: &VoteProgress{Voted: voted, Members: members},
+		}, nil
+	case UpdateTypeRoundClosed:
+		if len(parts) != 2 {
+			return RoomSubscriptionMessage{}, errMalformedMessage
+		}
+		return RoomSubscriptionMessage{
+			Type:   UpdateType(parts[0]),
+			Winner: parts[1],
+		}, nil
+	case UpdateTypeNewRound:
+		if len(parts) != 3 {
+			return RoomSubscriptionMessage{}, errMalformedMessage
+		}
+		round, _ := strconv.Atoi(parts[1])
+		return RoomSubscriptionMessage{
+			Type:       UpdateType(parts[0]),
+			Round:      round,
+			Candidates: strings.Split(parts[2], itemSep),
+		}, nil
+	case UpdateTypeTables:
+		if len(parts) < 2 {
+			return RoomSubscriptionMessage{}, errMalformedMessage
+		}
+		return RoomSubscriptionMessage{
+			Type:   UpdateType(parts[0]),
+			Tables: json.RawMessage(strings.Join(parts[1:], "::")),
+		}, nil
+	case UpdateTypePicked:
+		if len(parts) < 2 {
+			return RoomSubscriptionMessage{}, errMalformedMessage
+		}
+		return RoomSubscriptionMessage{
+			Type: UpdateType(parts[0]),
+			Pick: json.RawMessage(strings.Join(parts[1:], "::")),
+		}, nil
+	}
+	return RoomSubscriptionMessage{}, errMalformedMessage
+}
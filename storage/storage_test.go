@@ -0,0 +1,30 @@
+package storage
+
+import (
+	. "testing"
+)
+
+func TestResetMetaFields(t *T) {
+	tests := []struct {
+		state    RoomState
+		deadline bool
+	}{
+		{RoomStateCollecting, false},
+		{RoomStateVoting, false},
+		{RoomStateRevealed, true},
+		{RoomStateFinished, true},
+	}
+	for _, test := range tests {
+		fields := map[string]bool{}
+		for _, field := range resetMetaFields(test.state) {
+			fields[field] = true
+		}
+		// A pick from the discarded ballots must never be returned for the ballots cast after the reset
+		if !fields["pick"] {
+			t.Errorf("%s: expected the pick to be cleared, got %v", test.state, fields)
+		}
+		if fields["deadline"] != test.deadline {
+			t.Errorf("%s: expected clearing the deadline to be %v, got %v", test.state, test.deadline, fields)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package storage
+
+import "sort"
+
+// GameTally represents the number of votes and vetoes a single game received
+type GameTally struct {
+	GameID string `json:"gameID"`
+	Votes  int    `json:"votes"`
+	Vetoes int    `json:"vetoes"`
+}
+
+// Tally counts the votes and vetoes for each game, ordered from most to least popular.
+// Games with fewer vetoes win ties, followed by their ID so the order is stable.
+func (v VoteResult) Tally() []GameTally {
+	tallies := make(map[string]*GameTally)
+	get := func(gameID string) *GameTally {
+		if _, ok := tallies[gameID]; !ok {
+			tallies[gameID] = &GameTally{GameID: gameID}
+		}
+		return tallies[gameID]
+	}
+	for _, games := range v.Votes {
+		for _, gameID := range games {
+			if gameID != "" {
+				get(gameID).Votes++
+			}
+		}
+	}
+	for _, games := range v.Vetoes {
+		for _, gameID := range games {
+			if gameID != "" {
+				get(gameID).Vetoes++
+			}
+		}
+	}
+
+	res := make([]GameTally, 0, len(tallies))
+	for _, tally := range tallies {
+		res = append(res, *tally)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Votes != res[j].Votes {
+			return res[i].Votes > res[j].Votes
+		}
+		if res[i].Vetoes != res[j].Vetoes {
+			return res[i].Vetoes < res[j].Vetoes
+		}
+		return res[i].GameID < res[j].GameID
+	})
+	return res
+}
+
+// Winner returns the most popular game that nobody vetoed, or an empty string if there isn't one
+func (v VoteResult) Winner() string {
+	for _, tally := range v.Tally() {
+		if tally.Vetoes == 0 && tally.Votes > 0 {
+			return tally.GameID
+		}
+	}
+	return ""
+}
@@ -0,0 +1,58 @@
+package storage
+
+import (
+	. "testing"
+)
+
+func TestTally(t *T) {
+	votes := VoteResult{
+		Votes: map[string][]string{
+			"alice": {"1", "2"},
+			"bob":   {"2", "3"},
+			"carol": {"3"},
+		},
+		Vetoes: map[string][]string{
+			"alice": {"3"},
+			"bob":   {""},
+		},
+	}
+
+	tally := votes.Tally()
+	expected := []GameTally{
+		{GameID: "2", Votes: 2},
+		{GameID: "3", Votes: 2, Vetoes: 1},
+		{GameID: "1", Votes: 1},
+	}
+	if len(tally) != len(expected) {
+		t.Fatalf("expected %d tallies, got %d: %+v", len(expected), len(tally), tally)
+	}
+	for i := range expected {
+		if tally[i] != expected[i] {
+			t.Errorf("expected tally %d to be %+v, got %+v", i, expected[i], tally[i])
+		}
+	}
+
+	if winner := votes.Winner(); winner != "2" {
+		t.Errorf("expected winner to be 2, got %q", winner)
+	}
+}
+
+func TestWinnerSkipsVetoedGames(t *T) {
+	votes := VoteResult{
+		Votes:  map[string][]string{"alice": {"1"}},
+		Vetoes: map[string][]string{"bob": {"1"}},
+	}
+	if winner := votes.Winner(); winner != "" {
+		t.Errorf("expected no winner, got %q", winner)
+	}
+}
+
+func TestFilterCandidates(t *T) {
+	filtered := filterCandidates([]string{"1", "2", "3"}, []string{"3", "1"})
+	if len(filtered) != 2 || filtered[0] != "1" || filtered[1] != "3" {
+		t.Errorf("expected [1 3], got %v", filtered)
+	}
+	if all := filterCandidates([]string{"1", "2"}, nil); len(all) != 2 {
+		t.Errorf("expected every game to be kept without candidates, got %v", all)
+	}
+}
@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"context"
+	"errors"
+
+	"github.com/go-redis/redis"
+)
+
+var ErrVoterClaimed = errors.New("someone else is already voting as that user")
+
+// ClaimVoter checks a token against the one issued to a user voting in a room, issuing the given token
+// if the user hasn't voted before. It returns the user's token, or ErrVoterClaimed if the token given
+// isn't theirs.
+func (s *Storage) ClaimVoter(ctx context.Context, roomID, user, token string) (string, error) {
+	client := s.redisClient.WithContext(ctx)
+	err := client.HSetNX("voters:"+roomID, user, token).Err()
+	if err != nil {
+		return "", err
+	}
+	go s.SetExpire(roomID)
+	issued, err := client.HGet("voters:"+roomID, user).Result()
+	if err != nil {
+		return "", err
+	}
+	if issued != token {
+		return "", ErrVoterClaimed
+	}
+	return issued, nil
+}
+
+// IsVoter returns whether a token is the one issued to a user voting in a room
+func (s *Storage) IsVoter(ctx context.Context, roomID, user, token string) (bool, error) {
+	if user == "" || token == "" {
+		return false, nil
+	}
+	issued, err := s.redisClient.WithContext(ctx).HGet("voters:"+roomID, user).Result()
+	if err == redis.Nil {
+		return false, nil
+	}
+	return issued == token, err
+}